@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/c0deaddict/midimix/internal/learn"
+	"github.com/c0deaddict/midimix/internal/leds"
+	"github.com/c0deaddict/midimix/internal/midiclient"
+)
+
+// learnCommand asks to touch a control for each of the config paths in args and
+// writes the captured keys into the config file. The MIDI input is opened
+// directly, so this also works next to a running daemon.
+func learnCommand(args []string) {
+	flags := flag.NewFlagSet("learn", flag.ExitOnError)
+	timeout := flags.Duration("timeout", 30*time.Second, "time to wait for each control")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		log.Fatal().Msg("usage: learn [-timeout 30s] <path>... (e.g. pulseaudio.targets.spotify.mute)")
+	}
+	cfg := readConfig()
+
+	midi, err := midiclient.OpenAll(cfg, nil)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to open midi")
+	}
+	defer midi.Close()
+
+	ch := make(chan midiclient.MidiMessage)
+	stop, err := midi.Listen(ch)
+	if err != nil {
+		log.Fatal().Err(err).Msg("midi listen failed")
+	}
+	defer stop()
+
+	engine := leds.New(midi, nil)
+	defer engine.Close()
+
+	learner := learn.New(cfg, engine)
+	defer learner.Close()
+	go func() {
+		for msg := range ch {
+			learner.Offer(msg)
+		}
+	}()
+
+	for _, path := range flags.Args() {
+		if _, err := learner.Learn(cfg.File, path, *timeout); err != nil {
+			log.Error().Err(err).Msgf("learn %s failed", path)
+		}
+	}
+}
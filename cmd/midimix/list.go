@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/midiclient"
+	"github.com/c0deaddict/midimix/internal/paclient"
+)
+
+type listing struct {
+	Midi       []midiclient.Port `json:"midi"`
+	PulseAudio []paclient.Object `json:"pulseaudio"`
+}
+
+// listCommand prints the MIDI ports and PulseAudio objects with the names
+// the config matches on. Without a config, nothing is matched.
+func listCommand(args []string) {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	asJson := flags.Bool("json", false, "output JSON instead of a table")
+	flags.Parse(args)
+
+	cfg, err := config.Read(os.ExpandEnv(*configFile))
+	if err != nil {
+		log.Warn().Err(err).Msg("listing without config")
+		cfg = &config.Config{}
+	}
+
+	objects, err := paclient.List(cfg.PulseAudio)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to list pulseaudio objects")
+	}
+
+	l := listing{
+		Midi:       midiclient.Ports(cfg.Devices),
+		PulseAudio: objects,
+	}
+
+	if *asJson {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(l); err != nil {
+			log.Fatal().Err(err).Msg("failed to encode listing")
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "MIDI PORT\tNUMBER\tNAME\tDEVICE")
+	for _, port := range l.Midi {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", port.Direction, port.Number, port.Name, port.Device)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "TYPE\tINDEX\tMATCH NAME\tTARGETS\tPROPERTIES")
+	for _, obj := range l.PulseAudio {
+		matchName := obj.MatchName
+		if obj.Monitor {
+			matchName += " (monitor)"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", obj.Type, obj.Index, matchName, strings.Join(obj.Targets, ", "), formatProps(obj))
+	}
+
+	w.Flush()
+}
+
+func formatProps(obj paclient.Object) string {
+	props := []string{fmt.Sprintf("name=%s", obj.Name)}
+	keys := make([]string, 0, len(obj.Props))
+	for key := range obj.Props {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		props = append(props, fmt.Sprintf("%s=%q", key, obj.Props[key]))
+	}
+	return strings.Join(props, " ")
+}
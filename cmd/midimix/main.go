@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"runtime/pprof"
@@ -18,7 +19,27 @@ import (
 var configFile = flag.String("config", "$HOME/.config/midimix/config.yaml", "Config file")
 var cpuProfile = flag.String("cpuprofile", "", "write cpu profile to file")
 
+// commands read the config themselves, so that list works without one.
+var commands = map[string]func(args []string){
+	"run":     runCommand,
+	"learn":   learnCommand,
+	"list":    listCommand,
+	"monitor": monitorCommand,
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command] [args]\n\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "Commands:\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  run                 run the daemon (default)\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  learn <path>...     capture controls and write them into the config\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  list [-json]        list MIDI ports and PulseAudio objects\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  monitor [-local]    stream decoded MIDI events and what they caused\n\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "Flags:\n")
+	flag.PrintDefaults()
+}
+
 func main() {
+	flag.Usage = usage
 	flag.Parse()
 
 	if *cpuProfile != "" {
@@ -32,11 +53,32 @@ func main() {
 
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
 
+	name := "run"
+	args := flag.Args()
+	if len(args) != 0 {
+		name, args = args[0], args[1:]
+	}
+
+	command, ok := commands[name]
+	if !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	command(args)
+}
+
+// readConfig reads the config file, and exits when that fails.
+func readConfig() *config.Config {
 	cfg, err := config.Read(os.ExpandEnv(*configFile))
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to read config")
 	}
+	return cfg
+}
 
+func runCommand(args []string) {
+	cfg := readConfig()
 	midimix, err := midimix.Open(cfg)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to start midimix")
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/learn"
+	"github.com/c0deaddict/midimix/internal/midiclient"
+	"github.com/c0deaddict/midimix/internal/monitor"
+	"github.com/c0deaddict/midimix/internal/natsclient"
+)
+
+// monitorCommand streams the events of a running daemon. With -local the
+// MIDI input is opened directly and events are annotated with the config
+// bindings of the touched control, without acting on them.
+func monitorCommand(args []string) {
+	flags := flag.NewFlagSet("monitor", flag.ExitOnError)
+	local := flags.Bool("local", false, "open the MIDI device instead of attaching to the daemon")
+	asJson := flags.Bool("json", false, "output events as JSON lines")
+	flags.Parse(args)
+	cfg := readConfig()
+
+	output := func(event monitor.Event) {
+		if *asJson {
+			data, _ := json.Marshal(event)
+			fmt.Println(string(data))
+		} else {
+			fmt.Println(event.Format())
+		}
+	}
+
+	if *local {
+		stop := monitorLocal(cfg, output)
+		defer stop()
+	} else {
+		stop := monitorDaemon(cfg, output)
+		defer stop()
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	<-sigCh
+}
+
+func monitorDaemon(cfg *config.Config, output func(monitor.Event)) func() {
+	nc, err := natsclient.Connect("midimix-monitor", cfg.Nats)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to connect to nats")
+	}
+
+	_, err = nc.Subscribe(monitor.Subject, func(msg *nats.Msg) {
+		event := monitor.Event{}
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			log.Warn().Err(err).Msg("invalid monitor event")
+			return
+		}
+		output(event)
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to subscribe to monitor events")
+	}
+
+	// The daemon only publishes events while a monitor is attached.
+	attach := func() {
+		if err := nc.Publish(monitor.AttachSubject, nil); err != nil {
+			log.Warn().Err(err).Msg("attach to the daemon failed")
+		}
+	}
+	attach()
+	ticker := time.NewTicker(monitor.AttachInterval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				attach()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+		nc.Close()
+	}
+}
+
+func monitorLocal(cfg *config.Config, output func(monitor.Event)) func() {
+	midi, err := midiclient.OpenAll(cfg, nil)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to open midi")
+	}
+
+	ch := make(chan midiclient.MidiMessage)
+	stop, err := midi.Listen(ch)
+	if err != nil {
+		log.Fatal().Err(err).Msg("midi listen failed")
+	}
+
+	go func() {
+		var seq uint64
+		for msg := range ch {
+			seq++
+			output(monitor.Event{
+				Seq:     seq,
+				Time:    time.Now(),
+				Kind:    monitor.KindMidi,
+				Message: fmt.Sprintf("%T%+v", msg, msg),
+			})
+
+			device, key, ok := learn.Key(msg)
+			if !ok {
+				continue
+			}
+			bindings := cfg.Bindings(device, key)
+			if len(bindings) == 0 {
+				bindings = []string{"unbound"}
+			}
+			output(monitor.Event{
+				Seq:     seq,
+				Time:    time.Now(),
+				Kind:    monitor.KindBinding,
+				Message: strings.Join(bindings, ", "),
+			})
+		}
+	}()
+
+	return func() {
+		stop()
+		midi.Close()
+	}
+}
@@ -9,7 +9,7 @@ require (
 	github.com/nats-io/nats.go v1.32.0
 	github.com/rs/zerolog v1.31.0
 	gitlab.com/gomidi/midi/v2 v2.0.30
-	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
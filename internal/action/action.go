@@ -1,20 +1,101 @@
 package action
 
 import (
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/rs/zerolog/log"
+
+	"github.com/c0deaddict/midimix/internal/leds"
 	"github.com/c0deaddict/midimix/internal/midiclient"
+	"github.com/c0deaddict/midimix/internal/monitor"
 	"github.com/c0deaddict/midimix/internal/paclient"
 	"github.com/nats-io/nats.go"
 )
 
 type NewAction = func(clients *Clients, config map[string]interface{}) (Action, error)
 
+// Action handles MIDI messages. The effects of a message, such as NATS
+// publishes and LED changes, are shown in the monitor with its cause.
 type Action interface {
 	String() string
-	OnMidiMessage(msg midiclient.MidiMessage)
+	OnMidiMessage(msg midiclient.MidiMessage, cause monitor.Cause)
+}
+
+// Closer is implemented by actions that hold resources, which are released
+// on shutdown.
+type Closer interface {
+	Close()
 }
 
 type Clients struct {
 	Nats  *nats.Conn
-	Midi  *midiclient.MidiClient
+	Midi  *midiclient.Devices
+	Leds  *leds.Engine
 	Pulse *paclient.PulseAudioClient
+	Trace *monitor.Tracer
+	// Groups are the LED host groups from the config, by name.
+	Groups map[string]*Group
+	Master *Master
+
+	// subs are the subscriptions of Follow.
+	subs []*nats.Subscription
+}
+
+// Decode decodes an action config into out. Controls can be given as a key
+// number or by their name in the controller profile, and durations as a
+// string like "500ms".
+func (c *Clients) Decode(config map[string]interface{}, out interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			c.Midi.ControlHook(),
+			mapstructure.StringToTimeDurationHookFunc(),
+		),
+		Result: out,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(config)
+}
+
+// Publish publishes data on a NATS subject, and shows it in the monitor with
+// its cause.
+func (c *Clients) Publish(cause monitor.Cause, subject string, data []byte) error {
+	c.Trace.TraceCause(cause, monitor.KindNats, "%s %s", subject, data)
+	return c.Nats.Publish(subject, data)
+}
+
+// Timeout of requests for the current state of a host.
+const stateTimeout = 2 * time.Second
+
+// Follow calls handler with every state a host publishes on stateSubject,
+// and with the current state, which is requested on getSubject in the
+// background.
+func (c *Clients) Follow(stateSubject string, getSubject string, handler func(data []byte)) {
+	sub, err := c.Nats.Subscribe(stateSubject, func(msg *nats.Msg) {
+		handler(msg.Data)
+	})
+	if err != nil {
+		log.Error().Err(err).Msgf("subscribe to %s failed", stateSubject)
+	} else {
+		c.subs = append(c.subs, sub)
+	}
+
+	go func() {
+		msg, err := c.Nats.Request(getSubject, nil, stateTimeout)
+		if err != nil {
+			log.Warn().Err(err).Msgf("request %s failed", getSubject)
+			return
+		}
+		handler(msg.Data)
+	}()
+}
+
+// Unsubscribe ends the subscriptions of Follow.
+func (c *Clients) Unsubscribe() {
+	for _, sub := range c.subs {
+		sub.Unsubscribe()
+	}
+	c.subs = nil
 }
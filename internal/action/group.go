@@ -0,0 +1,118 @@
+package action
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/leds"
+	"github.com/c0deaddict/midimix/internal/midiclient"
+	"github.com/c0deaddict/midimix/internal/monitor"
+)
+
+// HostConfig selects the LED hosts of an action: a single host, a list of
+// hosts, or a group from the config.
+type HostConfig struct {
+	Host  string   `mapstructure:"host"`
+	Hosts []string `mapstructure:"hosts"`
+	Group string   `mapstructure:"group"`
+}
+
+// Group is the set of LED hosts an action sends to. Groups from the config
+// are shared by all actions that use them, so a link button changes what
+// all of them control. The link buttons are lit while their host is linked.
+type Group struct {
+	name   string
+	hosts  []config.LedHost
+	leds   *leds.Layer
+	mu     sync.Mutex
+	linked []bool
+}
+
+func NewGroup(name string, hosts []config.LedHost, engine *leds.Engine) *Group {
+	g := &Group{
+		name:   name,
+		hosts:  hosts,
+		linked: make([]bool, len(hosts)),
+	}
+	g.leds = engine.Layer(g.String(), leds.Normal)
+	for i, host := range hosts {
+		g.linked[i] = true
+		if host.Link != nil {
+			g.leds.SetLed(monitor.Cause{}, *host.Link, true)
+		}
+	}
+	return g
+}
+
+// Group returns the group of hosts that cfg selects.
+func (c *Clients) Group(cfg HostConfig) (*Group, error) {
+	switch {
+	case cfg.Group != "":
+		if cfg.Host != "" || len(cfg.Hosts) != 0 {
+			return nil, fmt.Errorf("configure either host, hosts or group")
+		}
+		group, ok := c.Groups[cfg.Group]
+		if !ok {
+			return nil, fmt.Errorf("unknown group %s", cfg.Group)
+		}
+		return group, nil
+	case cfg.Host != "":
+		if len(cfg.Hosts) != 0 {
+			return nil, fmt.Errorf("configure either host, hosts or group")
+		}
+		cfg.Hosts = []string{cfg.Host}
+	case len(cfg.Hosts) == 0:
+		return nil, fmt.Errorf("no host configured")
+	}
+
+	hosts := make([]config.LedHost, len(cfg.Hosts))
+	for i, host := range cfg.Hosts {
+		hosts[i] = config.LedHost{Host: host, Brightness: 1}
+	}
+	return NewGroup(strings.Join(cfg.Hosts, ","), hosts, c.Leds), nil
+}
+
+// Name returns the name of the group, or the hosts of a group that is not
+// in the config.
+func (g *Group) Name() string {
+	return g.name
+}
+
+func (g *Group) String() string {
+	return fmt.Sprintf("Group %s", g.name)
+}
+
+// Lead returns the first host of the group. Actions follow its state to keep
+// their controls in sync, also when it is not linked.
+func (g *Group) Lead() config.LedHost {
+	return g.hosts[0]
+}
+
+// Hosts returns the hosts that are linked.
+func (g *Group) Hosts() []config.LedHost {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	hosts := make([]config.LedHost, 0, len(g.hosts))
+	for i, host := range g.hosts {
+		if g.linked[i] {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// OnMidiMessage links or unlinks a host when its link button is pressed.
+func (g *Group) OnMidiMessage(msg midiclient.MidiMessage, cause monitor.Cause) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for i, host := range g.hosts {
+		if host.Link != nil && midiclient.Pressed(*host.Link, msg) {
+			g.linked[i] = !g.linked[i]
+			g.leds.SetLed(cause, *host.Link, g.linked[i])
+		}
+	}
+}
@@ -3,58 +3,164 @@ package ledanimation
 import (
 	"fmt"
 	"math"
+	"math/rand"
+	"sync"
 
-	"github.com/mitchellh/mapstructure"
+	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog/log"
 
 	"github.com/c0deaddict/midimix/internal/action"
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/leds"
 	"github.com/c0deaddict/midimix/internal/midiclient"
+	"github.com/c0deaddict/midimix/internal/monitor"
 )
 
+// Config has a knob that selects an animation over its range, buttons that
+// step through the animations, and buttons that each select one animation
+// and are lit while it is active. All of them are optional.
 type Config struct {
-	Key        uint8    `mapstructure:"key"`
-	Host       string   `mapstructure:"host"`
-	Animations []string `mapstructure:"animations"`
+	Key        config.Control   `mapstructure:"key"`
+	Next       *config.Control  `mapstructure:"next"`
+	Previous   *config.Control  `mapstructure:"previous"`
+	Random     *config.Control  `mapstructure:"random"`
+	Buttons    []config.Control `mapstructure:"buttons"`
+	Animations []string         `mapstructure:"animations"`
+
+	action.HostConfig `mapstructure:",squash"`
 }
 
 type LedAnimation struct {
 	*action.Clients
-	cfg       Config
+	cfg   Config
+	group *action.Group
+	leds  *leds.Layer
+	sub   *nats.Subscription
+	mu    sync.Mutex
+	// animation is the index of the active animation, or -1 when it is not
+	// known or not one of the configured animations.
 	animation int
 }
 
 func New(clients *action.Clients, config map[string]interface{}) (action.Action, error) {
-	led := LedAnimation{}
+	led := LedAnimation{animation: -1}
 	led.Clients = clients
-	if err := mapstructure.Decode(config, &led.cfg); err != nil {
+	if err := led.Decode(config, &led.cfg); err != nil {
 		return nil, err
 	}
 	if len(led.cfg.Animations) == 0 {
 		return nil, fmt.Errorf("no animations configured")
 	}
+	if len(led.cfg.Buttons) > len(led.cfg.Animations) {
+		return nil, fmt.Errorf("more buttons than animations configured")
+	}
+	group, err := clients.Group(led.cfg.HostConfig)
+	if err != nil {
+		return nil, err
+	}
+	led.group = group
+	led.leds = clients.Leds.Layer(led.String(), leds.Normal)
+
+	// Follow changes made elsewhere, so the buttons show the animation
+	// that is actually active on the lead host.
+	subject := subject(group.Lead().Host)
+	sub, err := clients.Nats.Subscribe(subject, led.onAnimation)
+	if err != nil {
+		log.Error().Err(err).Msgf("subscribe to %s failed", subject)
+	}
+	led.sub = sub
 	return &led, nil
 }
 
+// Close stops following the animation of the lead host.
+func (l *LedAnimation) Close() {
+	if l.sub != nil {
+		l.sub.Unsubscribe()
+	}
+}
+
 func (l *LedAnimation) String() string {
-	return fmt.Sprintf("LedAnimation host=%s", l.cfg.Host)
+	return fmt.Sprintf("LedAnimation host=%s", l.group.Name())
+}
+
+func subject(host string) string {
+	return fmt.Sprintf("leds.animation.%s", host)
 }
 
-func (l *LedAnimation) OnMidiMessage(msg midiclient.MidiMessage) {
+func (l *LedAnimation) OnMidiMessage(msg midiclient.MidiMessage, cause monitor.Cause) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	count := len(l.cfg.Animations)
+
 	switch msg := msg.(type) {
 	case midiclient.MidiControlChange:
-		if msg.Key == l.cfg.Key {
-			animation := int(math.Round(float64(msg.Value) * float64(len(l.cfg.Animations)-1)))
+		if l.cfg.Key.Is(msg.Device, msg.Key) {
+			animation := int(math.Round(float64(msg.Value) * float64(count-1)))
 			if l.animation != animation {
-				l.animation = animation
-				l.update()
+				l.set(cause, animation)
 			}
 		}
 	}
+
+	switch {
+	case l.cfg.Next != nil && midiclient.Pressed(*l.cfg.Next, msg):
+		l.set(cause, (l.animation+1)%count)
+	case l.cfg.Previous != nil && midiclient.Pressed(*l.cfg.Previous, msg):
+		if l.animation <= 0 {
+			l.set(cause, count-1)
+		} else {
+			l.set(cause, l.animation-1)
+		}
+	case l.cfg.Random != nil && midiclient.Pressed(*l.cfg.Random, msg):
+		animation := rand.Intn(count)
+		if count > 1 && animation == l.animation {
+			animation = (animation + 1 + rand.Intn(count-1)) % count
+		}
+		l.set(cause, animation)
+	}
+
+	for i, button := range l.cfg.Buttons {
+		if midiclient.Pressed(button, msg) {
+			l.set(cause, i)
+		}
+	}
+}
+
+// set activates an animation. Must be called with the lock held.
+func (l *LedAnimation) set(cause monitor.Cause, animation int) {
+	l.animation = animation
+	l.updateLeds(cause)
+	l.update(cause)
+}
+
+// onAnimation handles an animation that was set on the host.
+func (l *LedAnimation) onAnimation(msg *nats.Msg) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.animation = -1
+	for i, animation := range l.cfg.Animations {
+		if animation == string(msg.Data) {
+			l.animation = i
+		}
+	}
+	l.updateLeds(monitor.Cause{}.By(l.String()))
+}
+
+func (l *LedAnimation) updateLeds(cause monitor.Cause) {
+	for i, button := range l.cfg.Buttons {
+		l.leds.SetLed(cause, button, i == l.animation)
+	}
 }
 
-func (l *LedAnimation) update() error {
+// update sends the active animation to all linked hosts.
+func (l *LedAnimation) update(cause monitor.Cause) {
 	animation := l.cfg.Animations[l.animation]
-	log.Info().Msgf("setting animation of %s to %s", l.cfg.Host, animation)
-	subject := fmt.Sprintf("leds.animation.%s", l.cfg.Host)
-	return l.Nats.Publish(subject, []byte(animation))
+	for _, host := range l.group.Hosts() {
+		log.Info().Msgf("setting animation of %s to %s", host.Host, animation)
+		if err := l.Publish(cause, subject(host.Host), []byte(animation)); err != nil {
+			log.Error().Err(err).Msgf("set animation of %s failed", host.Host)
+		}
+	}
 }
@@ -0,0 +1,225 @@
+package ledcolor
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+const (
+	FormatRGB   = "rgb"
+	FormatHSV   = "hsv"
+	FormatRGBW  = "rgbw"
+	FormatCCT   = "cct"
+	FormatHCL   = "hcl"
+	FormatOkLCH = "oklch"
+)
+
+const (
+	EncodingHex   = "hex"
+	EncodingJSON  = "json"
+	EncodingBytes = "bytes"
+)
+
+// format converts the values of the controls, all between 0 and 1, to the
+// channels of a LED strip, and back.
+type format struct {
+	controls int
+	channels []string
+	convert  func(cfg *Config, values []float64) []float64
+	invert   func(cfg *Config, channels []float64) []float64
+}
+
+func identity(cfg *Config, v []float64) []float64 {
+	return v
+}
+
+var formats = map[string]format{
+	FormatRGB: {3, []string{"r", "g", "b"}, identity, identity},
+	FormatHSV: {3, []string{"r", "g", "b"},
+		func(cfg *Config, v []float64) []float64 {
+			return rgb(colorful.Hsv(360*v[0], v[1], v[2]))
+		},
+		func(cfg *Config, c []float64) []float64 {
+			h, s, v := color(c).Hsv()
+			return []float64{h / 360, s, v}
+		},
+	},
+	FormatRGBW: {4, []string{"r", "g", "b", "w"}, identity, identity},
+	// The first control is the color temperature, between minKelvin and
+	// maxKelvin, and the second the brightness. The temperature is mixed
+	// from the warm and cold white LEDs of the strip.
+	FormatCCT: {2, []string{"ww", "cw"},
+		func(cfg *Config, v []float64) []float64 {
+			m := mired(cfg.MinKelvin) + v[0]*(mired(cfg.MaxKelvin)-mired(cfg.MinKelvin))
+			cold := (mired(cfg.WarmKelvin) - m) / (mired(cfg.WarmKelvin) - mired(cfg.ColdKelvin))
+			cold = math.Max(0, math.Min(1, cold))
+			return []float64{(1 - cold) * v[1], cold * v[1]}
+		},
+		func(cfg *Config, c []float64) []float64 {
+			brightness := math.Min(1, c[0]+c[1])
+			if brightness == 0 {
+				return []float64{0.5, 0}
+			}
+			cold := c[1] / (c[0] + c[1])
+			m := mired(cfg.WarmKelvin) + cold*(mired(cfg.ColdKelvin)-mired(cfg.WarmKelvin))
+			t := (m - mired(cfg.MinKelvin)) / (mired(cfg.MaxKelvin) - mired(cfg.MinKelvin))
+			return []float64{math.Max(0, math.Min(1, t)), brightness}
+		},
+	},
+	FormatHCL: {3, []string{"r", "g", "b"},
+		func(cfg *Config, v []float64) []float64 {
+			return rgb(colorful.Hcl(360*v[0], v[1], v[2]))
+		},
+		func(cfg *Config, c []float64) []float64 {
+			h, chroma, l := color(c).Hcl()
+			return []float64{h / 360, chroma, l}
+		},
+	},
+	// Hue, chroma and lightness, in the same order as hcl. Chroma is scaled
+	// to 0.4, about the most saturated sRGB color.
+	FormatOkLCH: {3, []string{"r", "g", "b"},
+		func(cfg *Config, v []float64) []float64 {
+			return rgb(okLch(v[2], 0.4*v[1], 360*v[0]))
+		},
+		func(cfg *Config, c []float64) []float64 {
+			l, chroma, h := toOkLch(color(c))
+			return []float64{h / 360, chroma / 0.4, l}
+		},
+	},
+}
+
+// shiftHue shifts the hue of the red, green and blue channels by degrees.
+// Channels of formats without colors are returned as they are.
+func shiftHue(f format, channels []float64, degrees float64) []float64 {
+	if degrees == 0 || len(f.channels) < 3 || f.channels[0] != "r" {
+		return channels
+	}
+
+	h, s, v := color(channels).Hsv()
+	h = math.Mod(h+degrees, 360)
+	if h < 0 {
+		h += 360
+	}
+	return append(rgb(colorful.Hsv(h, s, v)), channels[3:]...)
+}
+
+// mired converts a color temperature to micro reciprocal degrees, in which
+// equal steps look about equally large.
+func mired(kelvin float64) float64 {
+	return 1e6 / kelvin
+}
+
+func rgb(c colorful.Color) []float64 {
+	c = c.Clamped()
+	return []float64{c.R, c.G, c.B}
+}
+
+func color(channels []float64) colorful.Color {
+	return colorful.Color{R: channels[0], G: channels[1], B: channels[2]}
+}
+
+// okLch converts an OkLCH color to sRGB, see
+// https://bottosson.github.io/posts/oklab/.
+func okLch(l, c, h float64) colorful.Color {
+	a := c * math.Cos(h*math.Pi/180)
+	b := c * math.Sin(h*math.Pi/180)
+
+	l_ := l + 0.3963377774*a + 0.2158037573*b
+	m_ := l - 0.1055613458*a - 0.0638541728*b
+	s_ := l - 0.0894841775*a - 1.2914855480*b
+
+	lc, mc, sc := l_*l_*l_, m_*m_*m_, s_*s_*s_
+
+	return colorful.LinearRgb(
+		+4.0767416621*lc-3.3077115913*mc+0.2309699292*sc,
+		-1.2684380046*lc+2.6097574011*mc-0.3413193965*sc,
+		-0.0041960771*lc-0.7034186147*mc+1.7076147010*sc,
+	)
+}
+
+// toOkLch converts an sRGB color to OkLCH.
+func toOkLch(c colorful.Color) (l, chroma, h float64) {
+	r, g, b := c.LinearRgb()
+
+	lc := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*b)
+	mc := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*b)
+	sc := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*b)
+
+	l = 0.2104542553*lc + 0.7936177850*mc - 0.0040720468*sc
+	a := 1.9779984951*lc - 2.4285922050*mc + 0.4505937099*sc
+	bb := 0.0259040371*lc + 0.7827717662*mc - 0.8086757660*sc
+
+	chroma = math.Hypot(a, bb)
+	h = math.Atan2(bb, a) * 180 / math.Pi
+	if h < 0 {
+		h += 360
+	}
+	return l, chroma, h
+}
+
+// encode turns channels between 0 and 1 into a payload.
+func encode(encoding string, names []string, channels []float64) ([]byte, error) {
+	values := make([]uint8, len(channels))
+	for i, v := range channels {
+		values[i] = uint8(math.Round(255 * math.Max(0, math.Min(1, v))))
+	}
+
+	switch encoding {
+	case EncodingJSON:
+		data := make(map[string]uint8, len(values))
+		for i, v := range values {
+			data[names[i]] = v
+		}
+		return json.Marshal(data)
+	case EncodingBytes:
+		return values, nil
+	case EncodingHex:
+		return []byte(hex.EncodeToString(values)), nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %s", encoding)
+	}
+}
+
+// decode turns a payload into channels between 0 and 1.
+func decode(encoding string, names []string, payload []byte) ([]float64, error) {
+	var values []byte
+
+	switch encoding {
+	case EncodingJSON:
+		data := make(map[string]float64)
+		if err := json.Unmarshal(payload, &data); err != nil {
+			return nil, err
+		}
+		channels := make([]float64, len(names))
+		for i, name := range names {
+			value, ok := data[name]
+			if !ok {
+				return nil, fmt.Errorf("no channel %s", name)
+			}
+			channels[i] = value / 255
+		}
+		return channels, nil
+	case EncodingBytes:
+		values = payload
+	case EncodingHex:
+		var err error
+		if values, err = hex.DecodeString(string(payload)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown encoding %s", encoding)
+	}
+
+	if len(values) != len(names) {
+		return nil, fmt.Errorf("expected %d channels, got %d", len(names), len(values))
+	}
+	channels := make([]float64, len(values))
+	for i, v := range values {
+		channels[i] = float64(v) / 255
+	}
+	return channels, nil
+}
@@ -0,0 +1,190 @@
+package ledcolor
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a, b []float64, tolerance float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > tolerance {
+			return false
+		}
+	}
+	return true
+}
+
+func TestConvert(t *testing.T) {
+	cfg := &Config{WarmKelvin: 2700, ColdKelvin: 6500, MinKelvin: 2700, MaxKelvin: 6500}
+	tests := []struct {
+		name   string
+		format string
+		values []float64
+		want   []float64
+	}{
+		{"rgb", FormatRGB, []float64{0.1, 0.2, 0.3}, []float64{0.1, 0.2, 0.3}},
+		{"hsv red", FormatHSV, []float64{0, 1, 1}, []float64{1, 0, 0}},
+		{"hsv green", FormatHSV, []float64{1.0 / 3, 1, 1}, []float64{0, 1, 0}},
+		{"hsv gray", FormatHSV, []float64{0.5, 0, 0.5}, []float64{0.5, 0.5, 0.5}},
+		{"cct warm", FormatCCT, []float64{0, 1}, []float64{1, 0}},
+		{"cct cold", FormatCCT, []float64{1, 0.5}, []float64{0, 0.5}},
+		{"cct middle", FormatCCT, []float64{0.5, 1}, []float64{0.5, 0.5}},
+		{"oklch white", FormatOkLCH, []float64{0, 0, 1}, []float64{1, 1, 1}},
+		{"oklch black", FormatOkLCH, []float64{0, 0, 0}, []float64{0, 0, 0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := formats[test.format].convert(cfg, test.values)
+			if !near(got, test.want, 1e-3) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestInvert(t *testing.T) {
+	cfg := &Config{WarmKelvin: 2700, ColdKelvin: 6500, MinKelvin: 2700, MaxKelvin: 6500}
+	tests := []struct {
+		name   string
+		format string
+		values []float64
+	}{
+		{"rgb", FormatRGB, []float64{0.1, 0.2, 0.3}},
+		{"rgbw", FormatRGBW, []float64{0.1, 0.2, 0.3, 0.4}},
+		{"hsv", FormatHSV, []float64{0.6, 0.5, 0.8}},
+		{"cct", FormatCCT, []float64{0.25, 0.8}},
+		{"hcl", FormatHCL, []float64{0.1, 0.2, 0.6}},
+		{"oklch", FormatOkLCH, []float64{0.4, 0.2, 0.7}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := formats[test.format]
+			got := f.invert(cfg, f.convert(cfg, test.values))
+			if !near(got, test.values, 1e-3) {
+				t.Fatalf("got %v, want %v", got, test.values)
+			}
+		})
+	}
+}
+
+func TestKelvinRange(t *testing.T) {
+	full := &Config{WarmKelvin: 2700, ColdKelvin: 6500, MinKelvin: 2700, MaxKelvin: 6500}
+	narrow := &Config{WarmKelvin: 2700, ColdKelvin: 6500, MinKelvin: 3000, MaxKelvin: 4000}
+	cct := formats[FormatCCT]
+
+	// The ends of the knob are the limits of the range, not the LEDs.
+	tests := []struct {
+		name   string
+		cfg    *Config
+		values []float64
+		want   []float64
+	}{
+		{"full warm", full, []float64{0, 1}, []float64{1, 0}},
+		{"full cold", full, []float64{1, 1}, []float64{0, 1}},
+		// 3000K is 333 mired, 2700K 370 and 6500K 154.
+		{"narrow warm", narrow, []float64{0, 1}, []float64{0.829, 0.171}},
+		// 4000K is 250 mired.
+		{"narrow cold", narrow, []float64{1, 1}, []float64{0.444, 0.556}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := cct.convert(test.cfg, test.values)
+			if !near(got, test.want, 1e-3) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+			if back := cct.invert(test.cfg, got); !near(back, test.values, 1e-9) {
+				t.Fatalf("inverted %v, want %v", back, test.values)
+			}
+		})
+	}
+
+	// Channels outside the range are clamped to its ends.
+	if got := cct.invert(narrow, []float64{1, 0}); !near(got, []float64{0, 1}, 1e-9) {
+		t.Fatalf("warm LED only: got %v, want the warm end", got)
+	}
+}
+
+func TestShiftHue(t *testing.T) {
+	got := shiftHue(formats[FormatRGB], []float64{1, 0, 0}, 120)
+	if !near(got, []float64{0, 1, 0}, 1e-9) {
+		t.Fatalf("shift red by 120: got %v, want green", got)
+	}
+	got = shiftHue(formats[FormatRGBW], []float64{1, 0, 0, 0.5}, -120)
+	if !near(got, []float64{0, 0, 1, 0.5}, 1e-9) {
+		t.Fatalf("shift red by -120: got %v, want blue and the same white", got)
+	}
+	got = shiftHue(formats[FormatCCT], []float64{0.2, 0.4}, 90)
+	if !near(got, []float64{0.2, 0.4}, 0) {
+		t.Fatalf("shift cct: got %v, want it unchanged", got)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	names := []string{"r", "g", "b"}
+	channels := []float64{1, 0.5, -1}
+	tests := []struct {
+		encoding string
+		want     string
+	}{
+		{EncodingHex, "ff8000"},
+		{EncodingBytes, "\xff\x80\x00"},
+		{EncodingJSON, `{"b":0,"g":128,"r":255}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.encoding, func(t *testing.T) {
+			got, err := encode(test.encoding, names, channels)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Fatalf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	if _, err := encode("base64", names, channels); err == nil {
+		t.Fatal("unknown encoding did not fail")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	names := []string{"r", "g", "b"}
+	want := []float64{1, 128.0 / 255, 0}
+	tests := []struct {
+		encoding string
+		payload  string
+		fails    bool
+	}{
+		{EncodingHex, "ff8000", false},
+		{EncodingBytes, "\xff\x80\x00", false},
+		{EncodingJSON, `{"r":255,"g":128,"b":0}`, false},
+		{EncodingHex, "ff80", true},
+		{EncodingHex, "zz8000", true},
+		{EncodingJSON, `{"r":255,"g":128}`, true},
+		{"base64", "/4AA", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.encoding+" "+test.payload, func(t *testing.T) {
+			got, err := decode(test.encoding, names, []byte(test.payload))
+			if test.fails {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !near(got, want, 1e-9) {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
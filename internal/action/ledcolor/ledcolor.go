@@ -2,82 +2,274 @@ package ledcolor
 
 import (
 	"fmt"
+	"math"
+	"sync"
 
-	"github.com/lucasb-eyer/go-colorful"
-	"github.com/mitchellh/mapstructure"
 	"github.com/rs/zerolog/log"
 
 	"github.com/c0deaddict/midimix/internal/action"
+	"github.com/c0deaddict/midimix/internal/config"
 	"github.com/c0deaddict/midimix/internal/midiclient"
-)
-
-const (
-	FormatRGB = "rgb"
-	FormatHSV = "hsv"
+	"github.com/c0deaddict/midimix/internal/monitor"
+	"github.com/c0deaddict/midimix/internal/transition"
 )
 
 type Config struct {
-	Host     string   `mapstructure:"host"`
-	Controls [3]uint8 `mapstructure:"controls"`
-	Format   string   `mapstructure:"format"`
+	Controls []config.Control `mapstructure:"controls"`
+	// Brightness scales all channels.
+	Brightness *config.Control `mapstructure:"brightness"`
+	Format     string          `mapstructure:"format"`
+	// Gamma corrects the channels, so the knobs look more even. 1 means no
+	// correction.
+	Gamma    float64 `mapstructure:"gamma"`
+	Encoding string  `mapstructure:"encoding"`
+	// The color temperatures of the warm and cold white LEDs of a CCT
+	// strip.
+	WarmKelvin float64 `mapstructure:"warmKelvin"`
+	ColdKelvin float64 `mapstructure:"coldKelvin"`
+	// The range of color temperatures of the knob of a CCT strip, the
+	// temperatures of its LEDs by default.
+	MinKelvin float64 `mapstructure:"minKelvin"`
+	MaxKelvin float64 `mapstructure:"maxKelvin"`
+	// Transition crossfades to a new color, instead of jumping to it.
+	Transition *transition.Config `mapstructure:"transition"`
+
+	action.HostConfig `mapstructure:",squash"`
 }
 
 type LedColor struct {
 	*action.Clients
-	cfg   Config
-	state [3]float32
+	cfg        Config
+	group      *action.Group
+	format     format
+	mu         sync.Mutex
+	state      []action.Pickup
+	brightness float64
+	// known is true once the color was set or received, so a change of the
+	// master brightness does not send a color that is not known.
+	known bool
+	// fade is the running crossfade, and shown the channels that were last
+	// sent to each host, where a crossfade starts from.
+	fade  *transition.Transition
+	shown map[string][]float64
 }
 
 func New(clients *action.Clients, config map[string]interface{}) (action.Action, error) {
-	led := LedColor{}
+	led := LedColor{brightness: 1, shown: make(map[string][]float64)}
 	led.Clients = clients
-	if err := mapstructure.Decode(config, &led.cfg); err != nil {
+	led.cfg = Config{
+		Format:     FormatRGB,
+		Gamma:      1,
+		Encoding:   EncodingHex,
+		WarmKelvin: 2700,
+		ColdKelvin: 6500,
+	}
+	if err := led.Decode(config, &led.cfg); err != nil {
+		return nil, err
+	}
+	if led.cfg.MinKelvin == 0 {
+		led.cfg.MinKelvin = led.cfg.WarmKelvin
+	}
+	if led.cfg.MaxKelvin == 0 {
+		led.cfg.MaxKelvin = led.cfg.ColdKelvin
+	}
+
+	format, ok := formats[led.cfg.Format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %s", led.cfg.Format)
+	}
+	if len(led.cfg.Controls) != format.controls {
+		return nil, fmt.Errorf("format %s needs %d controls", led.cfg.Format, format.controls)
+	}
+	if led.cfg.WarmKelvin <= 0 || led.cfg.ColdKelvin <= led.cfg.WarmKelvin {
+		return nil, fmt.Errorf("coldKelvin must be above warmKelvin")
+	}
+	if led.cfg.MaxKelvin <= led.cfg.MinKelvin {
+		return nil, fmt.Errorf("maxKelvin must be above minKelvin")
+	}
+	if led.cfg.MinKelvin < led.cfg.WarmKelvin || led.cfg.MaxKelvin > led.cfg.ColdKelvin {
+		return nil, fmt.Errorf("minKelvin and maxKelvin must be between warmKelvin and coldKelvin")
+	}
+	if led.cfg.Gamma <= 0 {
+		return nil, fmt.Errorf("gamma must be positive")
+	}
+	if _, err := encode(led.cfg.Encoding, nil, nil); err != nil {
 		return nil, err
 	}
+	if led.cfg.Transition != nil {
+		if err := led.cfg.Transition.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	group, err := clients.Group(led.cfg.HostConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	led.group = group
+	led.format = format
+	led.state = make([]action.Pickup, len(led.cfg.Controls))
+
+	clients.Master.OnBrightness(led.onMaster)
+
+	lead := group.Lead().Host
+	led.Follow(
+		fmt.Sprintf("leds.color.state.%s", lead),
+		fmt.Sprintf("leds.color.get.%s", lead),
+		led.onState,
+	)
 	return &led, nil
 }
 
 func (l *LedColor) String() string {
-	return fmt.Sprintf("LedColor host=%s", l.cfg.Host)
+	return fmt.Sprintf("LedColor host=%s", l.group.Name())
 }
 
-func (l *LedColor) OnMidiMessage(msg midiclient.MidiMessage) {
+func (l *LedColor) OnMidiMessage(msg midiclient.MidiMessage, cause monitor.Cause) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	switch msg := msg.(type) {
 	case midiclient.MidiControlChange:
 		update := false
 		for i, key := range l.cfg.Controls {
-			if key == msg.Key {
-				l.state[i] = msg.Value
-				update = true
+			if key.Is(msg.Device, msg.Key) {
+				if _, ok := l.state[i].Move(float64(msg.Value)); ok {
+					update = true
+				}
 			}
 		}
+		if l.cfg.Brightness != nil && l.cfg.Brightness.Is(msg.Device, msg.Key) {
+			l.brightness = float64(msg.Value)
+			update = true
+		}
 
 		if update {
-			if err := l.updateColor(); err != nil {
-				log.Warn().Err(err).Msg("nats update color failed")
-			}
+			l.known = true
+			l.updateColor(cause)
+		}
+	}
+}
+
+// onMaster sends the color again when the master brightness changed.
+func (l *LedColor) onMaster(brightness float64, cause monitor.Cause) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.known {
+		l.updateColor(cause.By(l.String()))
+	}
+}
+
+// onState keeps the knobs in sync with a color that was set elsewhere on
+// the lead host.
+func (l *LedColor) onState(data []byte) {
+	lead := l.group.Lead()
+	channels, err := decode(l.cfg.Encoding, l.format.channels, data)
+	if err != nil {
+		log.Warn().Err(err).Msgf("invalid color state of %s", lead.Host)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.shown[lead.Host] = append([]float64(nil), channels...)
+
+	// Undo the brightness and gamma correction, and the offsets of the
+	// lead host.
+	brightness := l.brightness * lead.Brightness * l.Master.Brightness()
+	for i, v := range channels {
+		v = math.Pow(v, 1/l.cfg.Gamma)
+		if brightness > 0 {
+			v = math.Min(1, v/brightness)
 		}
+		channels[i] = v
 	}
+	channels = shiftHue(l.format, channels, -lead.HueShift)
+
+	for i, v := range l.format.invert(&l.cfg, channels) {
+		l.state[i].Set(math.Max(0, math.Min(1, v)))
+	}
+	l.known = true
 }
 
-func (l *LedColor) color() string {
-	switch l.cfg.Format {
-	case FormatHSV:
-		h := float64(360.0 * l.state[0])
-		s := float64(l.state[1])
-		v := float64(l.state[2])
-		return colorful.Hsv(h, s, v).Hex()[1:]
-
-	// case FormatRGB:
-	default:
-		r := uint8(255 * l.state[0])
-		g := uint8(255 * l.state[1])
-		b := uint8(255 * l.state[2])
-		return fmt.Sprintf("%02x%02x%02x", r, g, b)
+// channels returns the channels of the current color for host, with the
+// offsets of the host and brightness and gamma correction applied. The
+// brightness is scaled by the master brightness.
+func (l *LedColor) channels(host config.LedHost) []float64 {
+	brightness := l.brightness * host.Brightness * l.Master.Brightness()
+
+	values := make([]float64, len(l.state))
+	for i := range l.state {
+		values[i] = l.state[i].Value()
 	}
+
+	channels := l.format.convert(&l.cfg, values)
+	channels = shiftHue(l.format, channels, host.HueShift)
+	corrected := make([]float64, len(channels))
+	for i, v := range channels {
+		v = math.Min(1, math.Max(0, v*brightness))
+		corrected[i] = math.Pow(v, l.cfg.Gamma)
+	}
+	return corrected
 }
 
-func (l *LedColor) updateColor() error {
-	subject := fmt.Sprintf("leds.color.%s", l.cfg.Host)
-	return l.Nats.Publish(subject, []byte(l.color()))
+// updateColor sends the current color to all linked hosts, or starts a
+// crossfade to it. A crossfade that is running is replaced, and the new one
+// starts from the color that was last sent. Must be called with the lock
+// held.
+func (l *LedColor) updateColor(cause monitor.Cause) {
+	if l.cfg.Transition == nil {
+		for _, host := range l.group.Hosts() {
+			l.send(cause, host, l.channels(host))
+		}
+		return
+	}
+
+	if l.fade != nil {
+		l.fade.Stop()
+	}
+	from := make(map[string][]float64, len(l.shown))
+	for host, channels := range l.shown {
+		from[host] = channels
+	}
+
+	l.fade = transition.Start(*l.cfg.Transition, func(t *transition.Transition, progress float64) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if l.fade != t {
+			return
+		}
+
+		// The color is recomputed on every step, so the master brightness
+		// and links are followed during a crossfade.
+		for _, host := range l.group.Hosts() {
+			channels := l.channels(host)
+			if start, ok := from[host.Host]; ok && len(start) == len(channels) {
+				for i := range channels {
+					channels[i] = transition.Lerp(start[i], channels[i], progress)
+				}
+			}
+			l.send(cause, host, channels)
+		}
+		if progress == 1 {
+			l.fade = nil
+		}
+	})
+}
+
+// send sends channels to host. Must be called with the lock held.
+func (l *LedColor) send(cause monitor.Cause, host config.LedHost, channels []float64) {
+	l.shown[host.Host] = channels
+	payload, err := encode(l.cfg.Encoding, l.format.channels, channels)
+	if err != nil {
+		log.Warn().Err(err).Msgf("encode color of %s failed", host.Host)
+		return
+	}
+	subject := fmt.Sprintf("leds.color.%s", host.Host)
+	if err := l.Publish(cause, subject, payload); err != nil {
+		log.Warn().Err(err).Msgf("nats update color of %s failed", host.Host)
+	}
 }
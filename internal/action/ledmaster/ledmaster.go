@@ -0,0 +1,57 @@
+package ledmaster
+
+import (
+	"fmt"
+
+	"github.com/c0deaddict/midimix/internal/action"
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/leds"
+	"github.com/c0deaddict/midimix/internal/midiclient"
+	"github.com/c0deaddict/midimix/internal/monitor"
+)
+
+// Config has a fader that scales the brightness of all LedColor actions,
+// and a button that turns off all LedMode hosts until it is pressed again.
+// The button is lit during the blackout. Both are optional.
+type Config struct {
+	Brightness *config.Control `mapstructure:"brightness"`
+	Blackout   *config.Control `mapstructure:"blackout"`
+}
+
+type LedMaster struct {
+	*action.Clients
+	cfg  Config
+	leds *leds.Layer
+}
+
+func New(clients *action.Clients, config map[string]interface{}) (action.Action, error) {
+	led := LedMaster{}
+	led.Clients = clients
+	if err := led.Decode(config, &led.cfg); err != nil {
+		return nil, err
+	}
+	if led.cfg.Brightness == nil && led.cfg.Blackout == nil {
+		return nil, fmt.Errorf("no brightness or blackout configured")
+	}
+	led.leds = clients.Leds.Layer(led.String(), leds.Normal)
+	return &led, nil
+}
+
+func (l *LedMaster) String() string {
+	return "LedMaster"
+}
+
+func (l *LedMaster) OnMidiMessage(msg midiclient.MidiMessage, cause monitor.Cause) {
+	switch msg := msg.(type) {
+	case midiclient.MidiControlChange:
+		if l.cfg.Brightness != nil && l.cfg.Brightness.Is(msg.Device, msg.Key) {
+			l.Master.SetBrightness(float64(msg.Value), cause)
+		}
+	}
+
+	if l.cfg.Blackout != nil && midiclient.Pressed(*l.cfg.Blackout, msg) {
+		blackout := !l.Master.Blackout()
+		l.leds.SetLed(cause, *l.cfg.Blackout, blackout)
+		l.Master.SetBlackout(blackout, cause)
+	}
+}
@@ -2,48 +2,107 @@ package ledmode
 
 import (
 	"fmt"
+	"sync"
+	"time"
 
-	"github.com/mitchellh/mapstructure"
+	"github.com/rs/zerolog/log"
 
 	"github.com/c0deaddict/midimix/internal/action"
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/leds"
 	"github.com/c0deaddict/midimix/internal/midiclient"
+	"github.com/c0deaddict/midimix/internal/monitor"
 )
 
 type Config struct {
-	Key  uint8  `mapstructure:"key"`
-	Host string `mapstructure:"host"`
+	Key               config.Control `mapstructure:"key"`
+	action.HostConfig `mapstructure:",squash"`
 }
 
+// How long the LED blinks when the mode could not be sent.
+const errorFlash = time.Second
+
 type LedMode struct {
 	*action.Clients
 	cfg   Config
+	group *action.Group
+	// mu guards state, that is also turned off by other actions.
+	mu    sync.Mutex
 	state bool
+	leds  *leds.Layer
+	alert *leds.Layer
 }
 
 func New(clients *action.Clients, config map[string]interface{}) (action.Action, error) {
 	led := LedMode{}
 	led.Clients = clients
-	if err := mapstructure.Decode(config, &led.cfg); err != nil {
+	if err := led.Decode(config, &led.cfg); err != nil {
+		return nil, err
+	}
+	group, err := clients.Group(led.cfg.HostConfig)
+	if err != nil {
 		return nil, err
 	}
+	led.group = group
+	led.leds = clients.Leds.Layer(led.String(), leds.Normal)
+	led.alert = clients.Leds.Layer(led.String(), leds.Alert)
+	clients.Master.OnBlackout(led.onBlackout)
+	clients.Master.OnTurnOff(led.turnOff)
 	return &led, nil
 }
 
 func (l *LedMode) String() string {
-	return fmt.Sprintf("LedMode host=%s", l.cfg.Host)
+	return fmt.Sprintf("LedMode host=%s", l.group.Name())
 }
 
-func (l *LedMode) OnMidiMessage(msg midiclient.MidiMessage) {
-	switch msg := msg.(type) {
-	case midiclient.MidiNoteOn:
-		if msg.Key == l.cfg.Key {
-			l.state = !l.state
-			l.updateMode()
-			l.Midi.SetLed(l.cfg.Key, l.state)
+func (l *LedMode) OnMidiMessage(msg midiclient.MidiMessage, cause monitor.Cause) {
+	if midiclient.Pressed(l.cfg.Key, msg) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.state = !l.state
+		l.leds.SetLed(cause, l.cfg.Key, l.state)
+		// The mode is sent when the blackout ends.
+		if !l.Master.Blackout() {
+			l.updateMode(cause, l.mode())
 		}
 	}
 }
 
+// onBlackout turns the hosts off during a blackout, and restores the mode
+// after it.
+func (l *LedMode) onBlackout(blackout bool, cause monitor.Cause) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	cause = cause.By(l.String())
+	if blackout {
+		l.updateMode(cause, "off")
+	} else {
+		l.updateMode(cause, l.mode())
+	}
+}
+
+// turnOff turns the mode off when host is one of the linked hosts, see
+// Master.TurnOff. All hosts of the group are turned off, as with the key.
+func (l *LedMode) turnOff(host string, cause monitor.Cause) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	cause = cause.By(l.String())
+
+	for _, h := range l.group.Hosts() {
+		if h.Host != host {
+			continue
+		}
+		l.state = false
+		l.leds.SetLed(cause, l.cfg.Key, false)
+		if !l.Master.Blackout() {
+			l.updateMode(cause, "off")
+		}
+		return true
+	}
+	return false
+}
+
+// mode returns the mode of the state. Must be called with the lock held.
 func (l *LedMode) mode() string {
 	if l.state {
 		return "on"
@@ -52,7 +111,14 @@ func (l *LedMode) mode() string {
 	}
 }
 
-func (l *LedMode) updateMode() error {
-	subject := fmt.Sprintf("leds.mode.%s", l.cfg.Host)
-	return l.Nats.Publish(subject, []byte(l.mode()))
+// updateMode sends mode to all linked hosts. The LED blinks when it could
+// not be sent to one of them. Must be called with the lock held.
+func (l *LedMode) updateMode(cause monitor.Cause, mode string) {
+	for _, host := range l.group.Hosts() {
+		subject := fmt.Sprintf("leds.mode.%s", host.Host)
+		if err := l.Publish(cause, subject, []byte(mode)); err != nil {
+			log.Error().Err(err).Msgf("set mode of %s failed", host.Host)
+			l.alert.Flash(cause, l.cfg.Key, leds.FastBlink, errorFlash)
+		}
+	}
 }
@@ -0,0 +1,133 @@
+package ledmode
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/c0deaddict/midimix/internal/action"
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/leds"
+	"github.com/c0deaddict/midimix/internal/midiclient"
+	"github.com/c0deaddict/midimix/internal/monitor"
+)
+
+type publish struct {
+	subject string
+	data    []byte
+}
+
+// serveNats speaks just enough of the NATS protocol to accept publishes,
+// which are sent on the returned channel. Subscribers of the attach subject
+// get one message, so a Tracer is attached.
+func serveNats(t *testing.T) (string, <-chan publish) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	pubs := make(chan publish, 100)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		fmt.Fprintf(conn, "INFO {\"server_id\":\"test\",\"version\":\"2.10.0\",\"max_payload\":1048576}\r\n")
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+
+			switch fields[0] {
+			case "PING":
+				fmt.Fprintf(conn, "PONG\r\n")
+			case "SUB":
+				if fields[1] == monitor.AttachSubject {
+					fmt.Fprintf(conn, "MSG %s %s 0\r\n\r\n", fields[1], fields[len(fields)-1])
+				}
+			case "PUB":
+				size, _ := strconv.Atoi(fields[len(fields)-1])
+				data := make([]byte, size+2)
+				if _, err := io.ReadFull(r, data); err != nil {
+					return
+				}
+				pubs <- publish{fields[1], data[:size]}
+			}
+		}
+	}()
+	return listener.Addr().String(), pubs
+}
+
+func TestPublishCause(t *testing.T) {
+	addr, pubs := serveNats(t)
+	nc, err := nats.Connect("nats://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	clients := &action.Clients{Nats: nc, Midi: &midiclient.Devices{}, Master: action.NewMaster()}
+	clients.Trace = monitor.New(nc)
+	defer clients.Trace.Close()
+	for start := time.Now(); !clients.Trace.Attached(); time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatal("monitor did not attach")
+		}
+	}
+	clients.Leds = leds.New(clients.Midi, clients.Trace)
+	defer clients.Leds.Close()
+
+	key := config.Control{Device: "midimix", Key: 1}
+	group := action.NewGroup("desk", []config.LedHost{{Host: "desk", Brightness: 1}}, clients.Leds)
+	l := &LedMode{Clients: clients, cfg: Config{Key: key}, group: group}
+	l.leds = clients.Leds.Layer(l.String(), leds.Normal)
+	l.alert = clients.Leds.Layer(l.String(), leds.Alert)
+
+	msg := midiclient.MidiNoteOn{Device: key.Device, Key: key.Key, Velocity: 1}
+	cause := clients.Trace.Begin(msg)
+	l.OnMidiMessage(msg, cause.By(l.String()))
+
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case pub := <-pubs:
+			if pub.subject != monitor.Subject {
+				continue
+			}
+			event := monitor.Event{}
+			if err := json.Unmarshal(pub.data, &event); err != nil {
+				t.Fatal(err)
+			}
+			if event.Kind != monitor.KindNats {
+				continue
+			}
+			if event.Seq != cause.Seq || event.Handler != l.String() {
+				t.Fatalf("got seq %d by %q, want seq %d by %q", event.Seq, event.Handler, cause.Seq, l.String())
+			}
+			if event.Message != "leds.mode.desk on" {
+				t.Fatalf("got %q, want the mode", event.Message)
+			}
+			return
+		case <-deadline:
+			t.Fatal("no publish in the monitor")
+		}
+	}
+}
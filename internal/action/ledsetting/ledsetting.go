@@ -1,67 +1,181 @@
 package ledsetting
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"sync"
 
-	"github.com/mitchellh/mapstructure"
 	"github.com/rs/zerolog/log"
 
 	"github.com/c0deaddict/midimix/internal/action"
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/leds"
 	"github.com/c0deaddict/midimix/internal/midiclient"
+	"github.com/c0deaddict/midimix/internal/monitor"
 )
 
+// Config has one control that patches one setting, given inline, or several
+// settings at once. Bool settings are toggled by a button, which is lit
+// while the settings are true. Other settings are set by a knob or fader.
 type Config struct {
-	Key      uint8   `mapstructure:"key"`
-	Host     string  `mapstructure:"host"`
-	Setting  string  `mapstructure:"setting"`
-	MinValue float32 `mapstructure:"minValue"`
-	MaxValue float32 `mapstructure:"maxValue"`
+	Key      config.Control `mapstructure:"key"`
+	Setting  `mapstructure:",squash"`
+	Settings []Setting `mapstructure:"settings"`
+
+	action.HostConfig `mapstructure:",squash"`
 }
 
 type LedSetting struct {
 	*action.Clients
-	cfg Config
+	cfg    Config
+	group  *action.Group
+	button bool
+	leds   *leds.Layer
+	mu     sync.Mutex
+	pickup action.Pickup
+	// state is the state of a button.
+	state bool
+	// patch is the last patch that was sent.
+	patch []byte
 }
 
 func New(clients *action.Clients, config map[string]interface{}) (action.Action, error) {
 	led := LedSetting{}
 	led.Clients = clients
-	if err := mapstructure.Decode(config, &led.cfg); err != nil {
+	if err := led.Decode(config, &led.cfg); err != nil {
 		return nil, err
 	}
-	if led.cfg.Setting == "" {
-		return nil, fmt.Errorf("no setting configured")
+
+	if len(led.cfg.Settings) == 0 {
+		led.cfg.Settings = []Setting{led.cfg.Setting}
+	} else if led.cfg.Setting.Setting != "" {
+		return nil, fmt.Errorf("configure either setting or settings")
+	}
+
+	for i := range led.cfg.Settings {
+		setting := &led.cfg.Settings[i]
+		if err := setting.validate(); err != nil {
+			return nil, err
+		}
+		button := setting.Type == TypeBool
+		if i > 0 && button != led.button {
+			return nil, fmt.Errorf("bool settings cannot be combined with other settings")
+		}
+		led.button = button
 	}
-	if led.cfg.MinValue >= led.cfg.MaxValue {
-		return nil, fmt.Errorf("minValue >= maxValue")
+
+	group, err := clients.Group(led.cfg.HostConfig)
+	if err != nil {
+		return nil, err
 	}
+	led.group = group
+	led.leds = clients.Leds.Layer(led.String(), leds.Normal)
+
+	lead := group.Lead().Host
+	led.Follow(
+		fmt.Sprintf("esp.settings.state.%s", lead),
+		fmt.Sprintf("esp.settings.get.%s", lead),
+		led.onState,
+	)
 	return &led, nil
 }
 
 func (l *LedSetting) String() string {
-	return fmt.Sprintf("LedSetting host=%s setting=%s", l.cfg.Host, l.cfg.Setting)
+	return fmt.Sprintf("LedSetting host=%s setting=%s", l.group.Name(), l.cfg.Settings[0].Setting)
 }
 
-func (l *LedSetting) OnMidiMessage(msg midiclient.MidiMessage) {
+func (l *LedSetting) OnMidiMessage(msg midiclient.MidiMessage, cause monitor.Cause) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.button {
+		if midiclient.Pressed(l.cfg.Key, msg) {
+			l.state = !l.state
+			l.leds.SetLed(cause, l.cfg.Key, l.state)
+			position := 0.0
+			if l.state {
+				position = 1
+			}
+			l.send(cause, position)
+		}
+		return
+	}
+
 	switch msg := msg.(type) {
 	case midiclient.MidiControlChange:
-		if msg.Key == l.cfg.Key {
-			value := l.cfg.MinValue + (msg.Value * (l.cfg.MaxValue - l.cfg.MinValue))
-			l.update(value)
+		if l.cfg.Key.Is(msg.Device, msg.Key) {
+			if position, ok := l.pickup.Move(float64(msg.Value)); ok {
+				l.send(cause, position)
+			}
 		}
 	}
 }
 
-func (l *LedSetting) update(value float32) error {
-	log.Info().Msgf("host %s setting %s to %f", l.cfg.Host, l.cfg.Setting, value)
-	data := make(map[string]float32)
-	data[l.cfg.Setting] = value
-	payload, err := json.Marshal(data)
+// send patches all settings to their value at position. Must be called with
+// the lock held.
+func (l *LedSetting) send(cause monitor.Cause, position float64) {
+	patch := make(map[string]interface{})
+	for i := range l.cfg.Settings {
+		setting := &l.cfg.Settings[i]
+		patch[setting.Setting] = setting.value(position)
+	}
+
+	if err := l.update(cause, patch); err != nil {
+		log.Warn().Err(err).Msg("marshal settings failed")
+	}
+}
+
+// onState keeps the control in sync with the settings when they were
+// changed elsewhere. The state is a JSON object with all settings of the
+// lead host. The first setting decides the position.
+func (l *LedSetting) onState(data []byte) {
+	state := make(map[string]interface{})
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Warn().Err(err).Msgf("invalid settings state of %s", l.group.Lead().Host)
+		return
+	}
+
+	setting := &l.cfg.Settings[0]
+	value, ok := state[setting.Setting]
+	if !ok {
+		return
+	}
+	position, ok := setting.position(value)
+	if !ok {
+		log.Warn().Msgf("invalid value %v of setting %s of %s", value, setting.Setting, l.group.Lead().Host)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.patch = nil
+	if l.button {
+		l.state = position >= 0.5
+		l.leds.SetLed(monitor.Cause{}.By(l.String()), l.cfg.Key, l.state)
+	} else {
+		l.pickup.Set(position)
+	}
+}
+
+func (l *LedSetting) update(cause monitor.Cause, patch map[string]interface{}) error {
+	payload, err := json.Marshal(patch)
 	if err != nil {
 		return err
 	}
+	// Int and enum settings only change every few steps of a knob.
+	if bytes.Equal(payload, l.patch) {
+		return nil
+	}
+	l.patch = payload
 
-	subject := fmt.Sprintf("esp.settings.patch.%s", l.cfg.Host)
-	return l.Nats.Publish(subject, []byte(payload))
+	for _, host := range l.group.Hosts() {
+		log.Info().Msgf("host %s settings %s", host.Host, payload)
+		subject := fmt.Sprintf("esp.settings.patch.%s", host.Host)
+		if err := l.Publish(cause, subject, payload); err != nil {
+			log.Warn().Err(err).Msgf("nats update settings of %s failed", host.Host)
+		}
+	}
+	return nil
 }
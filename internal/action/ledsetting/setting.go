@@ -0,0 +1,133 @@
+package ledsetting
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	TypeFloat = "float"
+	TypeInt   = "int"
+	TypeLog   = "log"
+	TypeEnum  = "enum"
+	TypeBool  = "bool"
+)
+
+// Setting is a setting of a host, and how a control position between 0 and
+// 1 maps to its value.
+type Setting struct {
+	Setting string `mapstructure:"setting"`
+	Type    string `mapstructure:"type"`
+	// MinValue and MaxValue are the range of float, int and log settings.
+	// The range of a log setting must be positive.
+	MinValue float64 `mapstructure:"minValue"`
+	MaxValue float64 `mapstructure:"maxValue"`
+	// Step rounds int settings, 1 by default.
+	Step int64 `mapstructure:"step"`
+	// Values are the values of an enum setting.
+	Values []string `mapstructure:"values"`
+}
+
+func (s *Setting) validate() error {
+	if s.Setting == "" {
+		return fmt.Errorf("no setting configured")
+	}
+
+	switch s.Type {
+	case "":
+		s.Type = TypeFloat
+		fallthrough
+	case TypeFloat, TypeInt, TypeLog:
+		if s.MinValue >= s.MaxValue {
+			return fmt.Errorf("%s: minValue >= maxValue", s.Setting)
+		}
+		if s.Type == TypeLog && s.MinValue <= 0 {
+			return fmt.Errorf("%s: minValue of a log setting must be positive", s.Setting)
+		}
+		if s.Step == 0 {
+			s.Step = 1
+		}
+		if s.Step < 0 {
+			return fmt.Errorf("%s: negative step", s.Setting)
+		}
+	case TypeEnum:
+		if len(s.Values) == 0 {
+			return fmt.Errorf("%s: no values configured", s.Setting)
+		}
+	case TypeBool:
+	default:
+		return fmt.Errorf("%s: unknown type %s", s.Setting, s.Type)
+	}
+
+	return nil
+}
+
+// value returns the value of the setting at position.
+func (s *Setting) value(position float64) interface{} {
+	switch s.Type {
+	case TypeInt:
+		// Steps are counted from minValue, and a step past maxValue is
+		// kept within the range.
+		step := float64(s.Step)
+		value := s.MinValue + math.Round(position*(s.MaxValue-s.MinValue)/step)*step
+		return int64(math.Round(math.Max(s.MinValue, math.Min(s.MaxValue, value))))
+	case TypeLog:
+		return s.MinValue * math.Pow(s.MaxValue/s.MinValue, position)
+	case TypeEnum:
+		index := int(position * float64(len(s.Values)))
+		if index >= len(s.Values) {
+			index = len(s.Values) - 1
+		}
+		return s.Values[index]
+	case TypeBool:
+		return position >= 0.5
+	default:
+		return s.MinValue + position*(s.MaxValue-s.MinValue)
+	}
+}
+
+// position returns the position of a value of the setting, as decoded from
+// JSON.
+func (s *Setting) position(value interface{}) (float64, bool) {
+	var position float64
+
+	switch value := value.(type) {
+	case float64:
+		switch s.Type {
+		case TypeFloat, TypeInt:
+			position = (value - s.MinValue) / (s.MaxValue - s.MinValue)
+		case TypeLog:
+			if value <= 0 {
+				return 0, false
+			}
+			position = math.Log(value/s.MinValue) / math.Log(s.MaxValue/s.MinValue)
+		default:
+			return 0, false
+		}
+	case string:
+		if s.Type != TypeEnum {
+			return 0, false
+		}
+		index := -1
+		for i, v := range s.Values {
+			if v == value {
+				index = i
+			}
+		}
+		if index < 0 {
+			return 0, false
+		}
+		position = (float64(index) + 0.5) / float64(len(s.Values))
+	case bool:
+		if s.Type != TypeBool {
+			return 0, false
+		}
+		if value {
+			position = 1
+		}
+	default:
+		return 0, false
+	}
+
+	return math.Max(0, math.Min(1, position)), true
+}
@@ -0,0 +1,78 @@
+package ledsetting
+
+import (
+	"math"
+	"testing"
+)
+
+func TestValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		setting  Setting
+		position float64
+		want     interface{}
+	}{
+		{"float", Setting{Type: TypeFloat, MinValue: 10, MaxValue: 20}, 0.25, 12.5},
+		{"int", Setting{Type: TypeInt, MinValue: 0, MaxValue: 255, Step: 1}, 0.5, int64(128)},
+		{"int step from min", Setting{Type: TypeInt, MinValue: 3, MaxValue: 23, Step: 5}, 0.3, int64(8)},
+		{"int step at min", Setting{Type: TypeInt, MinValue: 3, MaxValue: 23, Step: 5}, 0, int64(3)},
+		{"int step clamped", Setting{Type: TypeInt, MinValue: 0, MaxValue: 23, Step: 5}, 1, int64(23)},
+		{"log", Setting{Type: TypeLog, MinValue: 1, MaxValue: 100}, 0.5, 10.0},
+		{"enum", Setting{Type: TypeEnum, Values: []string{"a", "b", "c"}}, 0.5, "b"},
+		{"enum end", Setting{Type: TypeEnum, Values: []string{"a", "b", "c"}}, 1, "c"},
+		{"bool", Setting{Type: TypeBool}, 0.7, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.setting.value(test.position)
+			if f, ok := got.(float64); ok {
+				if math.Abs(f-test.want.(float64)) > 1e-9 {
+					t.Errorf("value(%v) = %v, want %v", test.position, got, test.want)
+				}
+			} else if got != test.want {
+				t.Errorf("value(%v) = %v, want %v", test.position, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPosition(t *testing.T) {
+	tests := []struct {
+		name    string
+		setting Setting
+		value   interface{}
+		want    float64
+		ok      bool
+	}{
+		{"float", Setting{Type: TypeFloat, MinValue: 10, MaxValue: 20}, 12.5, 0.25, true},
+		{"int", Setting{Type: TypeInt, MinValue: 3, MaxValue: 23, Step: 5}, 8.0, 0.25, true},
+		{"clamped", Setting{Type: TypeFloat, MinValue: 10, MaxValue: 20}, 30.0, 1, true},
+		{"log", Setting{Type: TypeLog, MinValue: 1, MaxValue: 100}, 10.0, 0.5, true},
+		{"log not positive", Setting{Type: TypeLog, MinValue: 1, MaxValue: 100}, 0.0, 0, false},
+		{"enum", Setting{Type: TypeEnum, Values: []string{"a", "b", "c"}}, "b", 0.5, true},
+		{"unknown enum", Setting{Type: TypeEnum, Values: []string{"a", "b", "c"}}, "d", 0, false},
+		{"bool", Setting{Type: TypeBool}, true, 1, true},
+		{"wrong type", Setting{Type: TypeBool}, "on", 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := test.setting.position(test.value)
+			if ok != test.ok || math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("position(%v) = %v, %v, want %v, %v", test.value, got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
+
+// A value maps back to the position it came from.
+func TestRoundTrip(t *testing.T) {
+	s := Setting{Type: TypeEnum, Values: []string{"a", "b", "c", "d"}}
+	for _, v := range s.Values {
+		position, _ := s.position(v)
+		if got := s.value(position); got != v {
+			t.Errorf("value(position(%s)) = %v", v, got)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package action
+
+import (
+	"sync"
+
+	"github.com/c0deaddict/midimix/internal/monitor"
+)
+
+// Master is the global LED master, that is set by the LedMaster action.
+// LedColor scales its brightness by the master brightness, and LedMode sends
+// off to its hosts during a blackout. Other actions turn hosts off through
+// the LedMode that controls them, see TurnOff.
+type Master struct {
+	mu         sync.Mutex
+	brightness float64
+	blackout   bool
+	onBright   []func(brightness float64, cause monitor.Cause)
+	onBlackout []func(blackout bool, cause monitor.Cause)
+	onTurnOff  []func(host string, cause monitor.Cause) bool
+}
+
+func NewMaster() *Master {
+	return &Master{brightness: 1}
+}
+
+func (m *Master) Brightness() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.brightness
+}
+
+func (m *Master) Blackout() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.blackout
+}
+
+// OnBrightness calls handler when the master brightness changes, with the
+// cause of the change.
+func (m *Master) OnBrightness(handler func(brightness float64, cause monitor.Cause)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onBright = append(m.onBright, handler)
+}
+
+// OnBlackout calls handler when a blackout starts or ends.
+func (m *Master) OnBlackout(handler func(blackout bool, cause monitor.Cause)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onBlackout = append(m.onBlackout, handler)
+}
+
+// OnTurnOff calls handler when a host is turned off with TurnOff. The
+// handler returns true when it controls the host, and turned it off.
+func (m *Master) OnTurnOff(handler func(host string, cause monitor.Cause) bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onTurnOff = append(m.onTurnOff, handler)
+}
+
+// TurnOff turns host off through the LedModes that control it, so their key
+// shows that it is off. It returns false when no LedMode controls the host.
+func (m *Master) TurnOff(host string, cause monitor.Cause) bool {
+	m.mu.Lock()
+	handlers := m.onTurnOff
+	m.mu.Unlock()
+
+	off := false
+	for _, handler := range handlers {
+		if handler(host, cause) {
+			off = true
+		}
+	}
+	return off
+}
+
+func (m *Master) SetBrightness(brightness float64, cause monitor.Cause) {
+	m.mu.Lock()
+	if m.brightness == brightness {
+		m.mu.Unlock()
+		return
+	}
+	m.brightness = brightness
+	handlers := m.onBright
+	m.mu.Unlock()
+
+	// The handlers are called without the lock, so they can read the
+	// master.
+	for _, handler := range handlers {
+		handler(brightness, cause)
+	}
+}
+
+func (m *Master) SetBlackout(blackout bool, cause monitor.Cause) {
+	m.mu.Lock()
+	if m.blackout == blackout {
+		m.mu.Unlock()
+		return
+	}
+	m.blackout = blackout
+	handlers := m.onBlackout
+	m.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(blackout, cause)
+	}
+}
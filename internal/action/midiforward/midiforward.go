@@ -0,0 +1,148 @@
+package midiforward
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/c0deaddict/midimix/internal/action"
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/midiclient"
+	"github.com/c0deaddict/midimix/internal/monitor"
+)
+
+// Rule forwards one control. Without cc, note or pitchBend the message is
+// forwarded as the same type and number it was received as. The value is
+// scaled to min..max, a min larger than max inverts the control.
+type Rule struct {
+	Control   config.Control `mapstructure:"control"`
+	Channel   uint8          `mapstructure:"channel"`
+	CC        *uint8         `mapstructure:"cc"`
+	Note      *uint8         `mapstructure:"note"`
+	PitchBend bool           `mapstructure:"pitchBend"`
+	Min       *float32       `mapstructure:"min"`
+	Max       *float32       `mapstructure:"max"`
+}
+
+type Config struct {
+	Output  string `mapstructure:"output"`
+	Virtual bool   `mapstructure:"virtual"`
+	Rules   []Rule `mapstructure:"rules"`
+}
+
+type MidiForward struct {
+	*action.Clients
+	cfg Config
+	out *midiclient.Output
+}
+
+func New(clients *action.Clients, config map[string]interface{}) (action.Action, error) {
+	f := MidiForward{}
+	f.Clients = clients
+	if err := f.Decode(config, &f.cfg); err != nil {
+		return nil, err
+	}
+	if f.cfg.Output == "" {
+		return nil, fmt.Errorf("no output configured")
+	}
+	if len(f.cfg.Rules) == 0 {
+		return nil, fmt.Errorf("no rules configured")
+	}
+	for i, rule := range f.cfg.Rules {
+		if rule.Channel > 15 {
+			return nil, fmt.Errorf("rule %d: channel out of range", i)
+		}
+		if rule.CC != nil && rule.Note != nil || rule.PitchBend && (rule.CC != nil || rule.Note != nil) {
+			return nil, fmt.Errorf("rule %d: only one of cc, note and pitchBend can be set", i)
+		}
+	}
+
+	out, err := midiclient.OpenOutput(f.cfg.Output, f.cfg.Virtual, clients.Trace)
+	if err != nil {
+		return nil, err
+	}
+	f.out = out
+
+	return &f, nil
+}
+
+func (f *MidiForward) String() string {
+	return fmt.Sprintf("MidiForward output=%s", f.cfg.Output)
+}
+
+// Close closes the output.
+func (f *MidiForward) Close() {
+	f.out.Close()
+}
+
+func (f *MidiForward) OnMidiMessage(msg midiclient.MidiMessage, cause monitor.Cause) {
+	switch msg := msg.(type) {
+	case midiclient.MidiControlChange:
+		for _, rule := range f.cfg.Rules {
+			if rule.Control.Is(msg.Device, msg.Key) {
+				f.forward(cause, rule, msg.Key, false, msg.Value, true)
+			}
+		}
+
+	case midiclient.MidiNoteOn:
+		for _, rule := range f.cfg.Rules {
+			if rule.Control.Is(msg.Device, msg.Key) {
+				f.forward(cause, rule, msg.Key, true, msg.Velocity, true)
+			}
+		}
+
+	case midiclient.MidiNoteOff:
+		for _, rule := range f.cfg.Rules {
+			if rule.Control.Is(msg.Device, msg.Key) {
+				f.forward(cause, rule, msg.Key, true, 0, false)
+			}
+		}
+	}
+}
+
+func (r *Rule) scale(value float32) float32 {
+	min, max := float32(0), float32(1)
+	if r.Min != nil {
+		min = *r.Min
+	}
+	if r.Max != nil {
+		max = *r.Max
+	}
+	return min + value*(max-min)
+}
+
+// forward sends a received note (or CC) with key and value. on is false for
+// note offs.
+func (f *MidiForward) forward(cause monitor.Cause, rule Rule, key uint8, note bool, value float32, on bool) {
+	var err error
+	value = rule.scale(value)
+
+	switch {
+	case rule.PitchBend:
+		err = f.out.PitchBend(cause, rule.Channel, value)
+
+	case rule.CC != nil:
+		err = f.out.ControlChange(cause, rule.Channel, *rule.CC, value)
+
+	case rule.Note != nil:
+		if on && value > 0 {
+			err = f.out.NoteOn(cause, rule.Channel, *rule.Note, value)
+		} else {
+			err = f.out.NoteOff(cause, rule.Channel, *rule.Note)
+		}
+
+	case note:
+		if on && value > 0 {
+			err = f.out.NoteOn(cause, rule.Channel, key, value)
+		} else {
+			err = f.out.NoteOff(cause, rule.Channel, key)
+		}
+
+	default:
+		err = f.out.ControlChange(cause, rule.Channel, key, value)
+	}
+
+	if err != nil {
+		log.Warn().Err(err).Msgf("forward %s failed", rule.Control)
+	}
+}
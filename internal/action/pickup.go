@@ -0,0 +1,59 @@
+package action
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// How close a knob must be to the value to pick it up.
+	pickupThreshold = 0.02
+	// Values that arrive shortly after the knob moved are most likely the
+	// echo of what the knob sent, and are ignored.
+	pickupHoldoff = time.Second
+)
+
+// Pickup implements soft takeover of a knob: when the value it controls is
+// changed elsewhere, the knob only takes over again once it reaches that
+// value, so the value does not jump on the next touch. Values and positions
+// are between 0 and 1.
+type Pickup struct {
+	value    float64
+	position float64
+	known    bool
+	detached bool
+	moved    time.Time
+}
+
+// Move handles a move of the knob. It returns the value, and true if the
+// knob controls it.
+func (p *Pickup) Move(position float64) (float64, bool) {
+	previous, known := p.position, p.known
+	p.position, p.known = position, true
+	p.moved = time.Now()
+
+	if p.detached {
+		crossed := known && (previous-p.value)*(position-p.value) <= 0
+		if !crossed && math.Abs(position-p.value) > pickupThreshold {
+			return p.value, false
+		}
+		p.detached = false
+	}
+
+	p.value = position
+	return p.value, true
+}
+
+// Set handles a value that was changed elsewhere.
+func (p *Pickup) Set(value float64) {
+	if time.Since(p.moved) < pickupHoldoff {
+		return
+	}
+	p.value = value
+	p.detached = !p.known || math.Abs(value-p.position) > pickupThreshold
+}
+
+// Value returns the current value.
+func (p *Pickup) Value() float64 {
+	return p.value
+}
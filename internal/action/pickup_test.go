@@ -0,0 +1,84 @@
+package action
+
+import (
+	"testing"
+	"time"
+)
+
+// set sets the value as if the knob was last moved long ago.
+func set(p *Pickup, value float64) {
+	p.moved = time.Time{}
+	p.Set(value)
+}
+
+func TestPickupFollows(t *testing.T) {
+	p := &Pickup{}
+	for _, position := range []float64{0.1, 0.5, 0.9} {
+		if value, ok := p.Move(position); !ok || value != position {
+			t.Fatalf("Move(%v) = %v, %v, want %v, true", position, value, ok, position)
+		}
+	}
+}
+
+func TestPickupTakeover(t *testing.T) {
+	tests := []struct {
+		name      string
+		start     float64
+		set       float64
+		moves     []float64
+		takesOver int
+	}{
+		// The knob is at 0.2 and the value is changed to 0.6 elsewhere.
+		{"crosses upward", 0.2, 0.6, []float64{0.3, 0.5, 0.7}, 2},
+		{"crosses downward", 0.9, 0.6, []float64{0.8, 0.7, 0.5}, 2},
+		{"reaches the value", 0.2, 0.6, []float64{0.4, 0.595}, 1},
+		{"close to the value", 0.59, 0.6, []float64{0.58}, 0},
+		{"moves away", 0.2, 0.6, []float64{0.1, 0, 0.05}, -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &Pickup{}
+			p.Move(test.start)
+			set(p, test.set)
+
+			for i, position := range test.moves {
+				value, ok := p.Move(position)
+				takesOver := test.takesOver >= 0 && i >= test.takesOver
+				if ok != takesOver {
+					t.Fatalf("Move(%v) controls the value: %v, want %v", position, ok, takesOver)
+				}
+				want := test.set
+				if takesOver {
+					want = position
+				}
+				if value != want {
+					t.Fatalf("Move(%v) = %v, want %v", position, value, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPickupUnknownPosition(t *testing.T) {
+	// Until the knob moved its position is unknown, so it must reach the
+	// value first.
+	p := &Pickup{}
+	set(p, 0.5)
+	if _, ok := p.Move(0.2); ok {
+		t.Fatal("knob at an unknown position took over")
+	}
+	if _, ok := p.Move(0.6); !ok {
+		t.Fatal("knob crossing the value did not take over")
+	}
+}
+
+func TestPickupHoldoff(t *testing.T) {
+	// A value that arrives right after the knob moved is its echo.
+	p := &Pickup{}
+	p.Move(0.2)
+	p.Set(0.6)
+	if value, ok := p.Move(0.25); !ok || value != 0.25 {
+		t.Fatalf("Move(0.25) = %v, %v, want 0.25, true", value, ok)
+	}
+}
@@ -0,0 +1,242 @@
+package sleeptimer
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/c0deaddict/midimix/internal/action"
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/leds"
+	"github.com/c0deaddict/midimix/internal/midiclient"
+	"github.com/c0deaddict/midimix/internal/monitor"
+	"github.com/c0deaddict/midimix/internal/transition"
+)
+
+// Config has a button that starts the timer and cancels it, and a knob that
+// picks its length between minLength and maxLength. The button blinks while
+// the timer runs, and blinks fast in the last minutes set by warning. The
+// leds show the remaining time as a bar. When the time runs out, the
+// PulseAudio target with the given id fades to mute, and the LED hosts, if
+// any are configured, are turned off.
+type Config struct {
+	Key       config.Control    `mapstructure:"key"`
+	Knob      *config.Control   `mapstructure:"knob"`
+	Leds      []config.Control  `mapstructure:"leds"`
+	Length    time.Duration     `mapstructure:"length"`
+	MinLength time.Duration     `mapstructure:"minLength"`
+	MaxLength time.Duration     `mapstructure:"maxLength"`
+	Warning   time.Duration     `mapstructure:"warning"`
+	Target    string            `mapstructure:"target"`
+	Fade      transition.Config `mapstructure:"fade"`
+
+	action.HostConfig `mapstructure:",squash"`
+}
+
+const (
+	// How often the bar is updated while the timer runs.
+	tick = time.Second
+	// How long the bar shows the length that the knob picked.
+	previewTime = 2 * time.Second
+)
+
+type SleepTimer struct {
+	*action.Clients
+	cfg    Config
+	group  *action.Group
+	leds   *leds.Layer
+	mu     sync.Mutex
+	length time.Duration
+	// stop is closed to cancel the running timer, and nil when the timer
+	// is not running.
+	stop chan struct{}
+}
+
+func New(clients *action.Clients, config map[string]interface{}) (action.Action, error) {
+	timer := SleepTimer{}
+	timer.Clients = clients
+	timer.cfg = Config{
+		Length:    30 * time.Minute,
+		MinLength: 5 * time.Minute,
+		MaxLength: 2 * time.Hour,
+		Warning:   time.Minute,
+		Fade:      transition.Config{Duration: 30 * time.Second, Easing: transition.Linear},
+	}
+	if err := timer.Decode(config, &timer.cfg); err != nil {
+		return nil, err
+	}
+
+	if timer.cfg.Target == "" {
+		return nil, fmt.Errorf("no target configured")
+	}
+	if !clients.Pulse.HasTarget(timer.cfg.Target) {
+		return nil, fmt.Errorf("unknown target %s", timer.cfg.Target)
+	}
+	if timer.cfg.MinLength <= 0 || timer.cfg.MaxLength <= timer.cfg.MinLength {
+		return nil, fmt.Errorf("maxLength must be above minLength, which must be positive")
+	}
+	if err := timer.cfg.Fade.Validate(); err != nil {
+		return nil, err
+	}
+
+	hosts := timer.cfg.HostConfig
+	if hosts.Host != "" || len(hosts.Hosts) != 0 || hosts.Group != "" {
+		group, err := clients.Group(hosts)
+		if err != nil {
+			return nil, err
+		}
+		timer.group = group
+	}
+
+	// The default length can be outside the range of the knob.
+	timer.length = min(max(timer.cfg.Length, timer.cfg.MinLength), timer.cfg.MaxLength)
+	timer.leds = clients.Leds.Layer(timer.String(), leds.Overlay)
+	return &timer, nil
+}
+
+func (s *SleepTimer) String() string {
+	return fmt.Sprintf("SleepTimer target=%s", s.cfg.Target)
+}
+
+func (s *SleepTimer) OnMidiMessage(msg midiclient.MidiMessage, cause monitor.Cause) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch msg := msg.(type) {
+	case midiclient.MidiControlChange:
+		if s.cfg.Knob != nil && s.cfg.Knob.Is(msg.Device, msg.Key) {
+			s.setLength(cause, float64(msg.Value))
+		}
+	}
+
+	if midiclient.Pressed(s.cfg.Key, msg) {
+		if s.stop != nil {
+			log.Info().Msgf("sleep timer of %s cancelled", s.cfg.Target)
+			s.cancel(cause)
+		} else {
+			log.Info().Msgf("sleep timer of %s set to %v", s.cfg.Target, s.length)
+			s.start()
+		}
+	}
+}
+
+// Close cancels the running timer.
+func (s *SleepTimer) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// setLength sets the length of the next timer from the position of the
+// knob, rounded to minutes, and shows it on the bar. Must be called with the
+// lock held.
+func (s *SleepTimer) setLength(cause monitor.Cause, position float64) {
+	span := float64(s.cfg.MaxLength - s.cfg.MinLength)
+	length := s.cfg.MinLength + time.Duration(position*span)
+	s.length = length.Round(time.Minute)
+
+	if s.stop == nil {
+		for i, led := range s.cfg.Leds {
+			pattern := leds.Off
+			if i < s.lit(s.length, s.cfg.MaxLength) {
+				pattern = leds.On
+			}
+			s.leds.Flash(cause, led, pattern, previewTime)
+		}
+	}
+}
+
+// lit returns how many LEDs of the bar show remaining out of length.
+func (s *SleepTimer) lit(remaining time.Duration, length time.Duration) int {
+	return int(math.Ceil(float64(len(s.cfg.Leds)) * float64(remaining) / float64(length)))
+}
+
+// start starts the timer. Must be called with the lock held.
+func (s *SleepTimer) start() {
+	stop := make(chan struct{})
+	s.stop = stop
+	go s.run(time.Now().Add(s.length), s.length, stop)
+}
+
+// cancel stops the timer. Must be called with the lock held.
+func (s *SleepTimer) cancel(cause monitor.Cause) {
+	close(s.stop)
+	s.stop = nil
+	s.leds.ReleaseAll(cause)
+}
+
+func (s *SleepTimer) run(end time.Time, length time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		s.mu.Lock()
+		// The timer was cancelled while waiting for the lock.
+		if s.stop != stop {
+			s.mu.Unlock()
+			return
+		}
+
+		remaining := time.Until(end)
+		if remaining <= 0 {
+			s.expire()
+			s.mu.Unlock()
+			return
+		}
+		s.updateLeds(remaining, length)
+		s.mu.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// updateLeds shows the remaining time. Must be called with the lock held.
+func (s *SleepTimer) updateLeds(remaining time.Duration, length time.Duration) {
+	cause := monitor.Cause{}.By(s.String())
+	pattern := leds.Blink
+	if remaining <= s.cfg.Warning {
+		pattern = leds.FastBlink
+	}
+	s.leds.Set(cause, s.cfg.Key, pattern)
+
+	lit := s.lit(remaining, length)
+	for i, led := range s.cfg.Leds {
+		s.leds.SetLed(cause, led, i < lit)
+	}
+}
+
+// expire fades the target to mute and turns off the LED hosts, through
+// their LedMode when they have one. Must be called with the lock held.
+func (s *SleepTimer) expire() {
+	log.Info().Msgf("sleep timer of %s expired", s.cfg.Target)
+	cause := monitor.Cause{}.By(s.String())
+	s.stop = nil
+	s.leds.ReleaseAll(cause)
+
+	if err := s.Pulse.FadeOut(s.cfg.Target, s.cfg.Fade); err != nil {
+		log.Error().Err(err).Msgf("sleep timer: fade out %s failed", s.cfg.Target)
+	}
+
+	if s.group == nil {
+		return
+	}
+	for _, host := range s.group.Hosts() {
+		if s.Master.TurnOff(host.Host, cause) {
+			continue
+		}
+		subject := fmt.Sprintf("leds.mode.%s", host.Host)
+		if err := s.Publish(cause, subject, []byte("off")); err != nil {
+			log.Error().Err(err).Msgf("sleep timer: turn off %s failed", host.Host)
+		}
+	}
+}
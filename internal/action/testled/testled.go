@@ -3,41 +3,45 @@ package testled
 import (
 	"fmt"
 
-	"github.com/mitchellh/mapstructure"
-
 	"github.com/c0deaddict/midimix/internal/action"
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/leds"
 	"github.com/c0deaddict/midimix/internal/midiclient"
+	"github.com/c0deaddict/midimix/internal/monitor"
 )
 
 type Config struct {
-	Key uint8
+	Key config.Control
 }
 
 type TestLed struct {
 	*action.Clients
 	cfg   Config
 	state bool
+	leds  *leds.Layer
 }
 
 func New(clients *action.Clients, config map[string]interface{}) (action.Action, error) {
 	led := TestLed{}
 	led.Clients = clients
-	if err := mapstructure.Decode(config, &led.cfg); err != nil {
+	if err := led.Decode(config, &led.cfg); err != nil {
 		return nil, err
 	}
+	led.leds = clients.Leds.Layer(led.String(), leds.Overlay)
 	return &led, nil
 }
 
 func (l *TestLed) String() string {
-	return fmt.Sprintf("TestLed key=%d", l.cfg.Key)
+	return fmt.Sprintf("TestLed key=%s", l.cfg.Key)
 }
 
-func (l *TestLed) OnMidiMessage(msg midiclient.MidiMessage) {
-	switch msg := msg.(type) {
-	case midiclient.MidiNoteOn:
-		if l.cfg.Key == msg.Key {
-			l.state = !l.state
-			l.Midi.SetLed(l.cfg.Key, l.state)
+func (l *TestLed) OnMidiMessage(msg midiclient.MidiMessage, cause monitor.Cause) {
+	if midiclient.Pressed(l.cfg.Key, msg) {
+		l.state = !l.state
+		if l.state {
+			l.leds.Set(cause, l.cfg.Key, leds.On)
+		} else {
+			l.leds.Release(cause, l.cfg.Key)
 		}
 	}
 }
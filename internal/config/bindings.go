@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Bindings returns the config paths that bind key on device, in the same
+// notation that SetControl uses. Notes and control changes share the key
+// space, so a binding might be for a different kind of control than the one
+// that was touched.
+func (c *Config) Bindings(device string, key uint8) []string {
+	paths := make([]string, 0)
+
+	type field struct {
+		name string
+		key  *Control
+	}
+	for _, target := range c.PulseAudio.Targets {
+		fields := []field{
+			{"mute", target.Mute},
+			{"default", target.Default},
+			{"presence", target.Presence},
+			{"volume", target.Volume},
+			{"profile", target.Profile},
+			{"port", target.Port},
+		}
+		if target.Meter != nil {
+			fields = append(fields, field{"meter.led", target.Meter.Led})
+		}
+		for i, profile := range target.Profiles {
+			fields = append(fields, field{fmt.Sprintf("profiles.%d.key", i), profile.Key})
+		}
+		for i, port := range target.Ports {
+			fields = append(fields, field{fmt.Sprintf("ports.%d.key", i), port.Key})
+		}
+		for _, field := range fields {
+			if field.key != nil && field.key.On(device, key) {
+				paths = append(paths, fmt.Sprintf("pulseaudio.targets.%s.%s", target.Name, field.name))
+			}
+		}
+	}
+
+	groups := make([]string, 0, len(c.Groups))
+	for name := range c.Groups {
+		groups = append(groups, name)
+	}
+	sort.Strings(groups)
+	for _, name := range groups {
+		for i, host := range c.Groups[name] {
+			if host.Link != nil && host.Link.On(device, key) {
+				paths = append(paths, fmt.Sprintf("groups.%s.%d.link", name, i))
+			}
+		}
+	}
+
+	for i, action := range c.Actions {
+		prefix := fmt.Sprintf("actions.%d.config", i)
+		paths = append(paths, c.findKey(prefix, action.Config, device, key)...)
+	}
+
+	return paths
+}
+
+// findKey walks a generic action config and returns the paths to controls
+// with key.
+func (c *Config) findKey(path string, value interface{}, device string, key uint8) []string {
+	paths := make([]string, 0)
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			paths = append(paths, c.findKey(path+"."+name, value[name], device, key)...)
+		}
+	case []interface{}:
+		for i, item := range value {
+			paths = append(paths, c.findKey(fmt.Sprintf("%s.%d", path, i), item, device, key)...)
+		}
+	case int:
+		if device == c.Devices[0].Name && value == int(key) {
+			paths = append(paths, path)
+		}
+	case string:
+		// Only strings that are controls, e.g. not host names.
+		control := parseName(value)
+		if control.Name == "" && control.Device == "" {
+			break
+		}
+		if c.Resolve(&control) == nil && control.On(device, key) {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths
+}
@@ -1,22 +1,42 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
 
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
+
+	"github.com/c0deaddict/midimix/internal/profile"
+	"github.com/c0deaddict/midimix/internal/transition"
 )
 
 type NatsConfig struct {
 	Url          string `yaml:"url"`
-	Username     string `yaml:"username",omitempty`
-	PasswordFile string `yaml:"passwordFile",omitempty`
+	Username     string `yaml:"username,omitempty"`
+	PasswordFile string `yaml:"passwordFile,omitempty"`
 }
 
+// DefaultDevice is the name of the MIDI device when only one is configured
+// under "midi".
+const DefaultDevice = "midi"
+
 type MidiConfig struct {
-	Input         string `yaml:"input"`
-	Output        string `yaml:"output"`
-	Channel       uint8  `yaml:"channel"`
-	MaxInputValue uint   `yaml:"maxInputValue"`
+	Name    string `yaml:"name,omitempty"`
+	Input   string `yaml:"input"`
+	Output  string `yaml:"output"`
+	Channel *uint8 `yaml:"channel,omitempty"`
+	// MaxInputValue is the value of a control at its maximum. It defaults
+	// to 127, the largest MIDI data byte.
+	MaxInputValue *uint `yaml:"maxInputValue,omitempty"`
+
+	// ProfileName is a built-in controller profile or a profile file.
+	ProfileName string           `yaml:"profile,omitempty"`
+	Profile     *profile.Profile `yaml:"-"`
 }
 
 type PulseAudioTargetType string
@@ -26,19 +46,169 @@ const (
 	RecordStream                        = "RecordStream"
 	Sink                                = "Sink"
 	Source                              = "Source"
+	Card                                = "Card"
+)
+
+// MuteMode is how the mute button of a target behaves.
+type MuteMode string
+
+const (
+	// MuteToggle toggles mute when the button is released.
+	MuteToggle MuteMode = "toggle"
+	// PushToTalk unmutes while the button is held.
+	PushToTalk MuteMode = "pushToTalk"
+	// PushToMute mutes while the button is held.
+	PushToMute MuteMode = "pushToMute"
+	// MuteHybrid toggles mute on a short tap, and is momentary when the
+	// button is held longer than the long press time of gestures.
+	MuteHybrid MuteMode = "hybrid"
 )
 
 type PulseAudioTarget struct {
-	Type     PulseAudioTargetType `yaml:"type"`
-	Name     string               `yaml:"name"`
-	Mute     *uint8               `yaml:"mute",omitempty`
-	Default  *uint8               `yaml:"default",omitempty`
-	Presence *uint8               `yaml:"presence",omitempty`
-	Volume   *uint8               `yaml:"volume",omitempty`
+	Type PulseAudioTargetType `yaml:"type"`
+	Name string               `yaml:"name"`
+	// Id is the name of the target in NATS subjects. It defaults to the
+	// name in lower case, with everything but letters and digits replaced
+	// by dashes.
+	Id       string   `yaml:"id,omitempty"`
+	Mute     *Control `yaml:"mute,omitempty"`
+	MuteMode MuteMode `yaml:"muteMode,omitempty"`
+	Default  *Control `yaml:"default,omitempty"`
+	Presence *Control `yaml:"presence,omitempty"`
+	Volume   *Control `yaml:"volume,omitempty"`
+
+	// Profile cycles through the profiles of a card. Its LED is on when
+	// the active profile is not the first one.
+	Profile  *Control `yaml:"profile,omitempty"`
+	Profiles []Option `yaml:"profiles,omitempty"`
+
+	// Port cycles through the ports of a sink or source, in the same way.
+	Port  *Control `yaml:"port,omitempty"`
+	Ports []Option `yaml:"ports,omitempty"`
+
+	// Fade fades the volume out before muting, and in after unmuting.
+	Fade *transition.Config `yaml:"fade,omitempty"`
+	// Glide glides to volumes that are set remotely. The fader always sets
+	// the volume right away.
+	Glide *transition.Config `yaml:"glide,omitempty"`
+
+	Meter *MeterConfig `yaml:"meter,omitempty"`
+}
+
+// MeterConfig measures the peak level of a target, to show when it makes
+// sound and when it clips. Sinks are measured on their monitor, and record
+// streams on their source.
+type MeterConfig struct {
+	// Threshold is the peak level in dB above which the target makes sound.
+	// It defaults to -50.
+	Threshold float64 `yaml:"threshold,omitempty"`
+	// Clip is the peak level in dB from which the target clips. It defaults
+	// to -0.5.
+	Clip float64 `yaml:"clip,omitempty"`
+	// Led is lit while the target makes sound. Without it, the presence LED
+	// blinks instead.
+	Led *Control `yaml:"led,omitempty"`
+}
+
+// Option is a profile of a card, or a port of a sink or source. It is
+// written as its name, or as a mapping with a key that selects the option,
+// and is lit while the option is active.
+type Option struct {
+	Name string   `yaml:"name"`
+	Key  *Control `yaml:"key,omitempty"`
+}
+
+func (o *Option) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*o = Option{}
+		return value.Decode(&o.Name)
+	}
+
+	type plain Option
+	return value.Decode((*plain)(o))
 }
 
 type PulseAudioConfig struct {
 	Targets []PulseAudioTarget `yaml:"targets"`
+	Ducking []DuckingRule      `yaml:"ducking,omitempty"`
+}
+
+// DuckingRule lowers the volume of targets while one of its triggers is
+// active. Triggers and targets are target ids.
+type DuckingRule struct {
+	Name     string           `yaml:"name"`
+	Triggers []DuckingTrigger `yaml:"triggers"`
+	Targets  []string         `yaml:"targets"`
+	// Amount is how much the targets are lowered, in dB.
+	Amount float64 `yaml:"amount"`
+	// Ramp is how the targets are lowered and raised again. It defaults to
+	// half a second.
+	Ramp *transition.Config `yaml:"ramp,omitempty"`
+}
+
+// DuckingWhen is when a trigger is active.
+type DuckingWhen string
+
+const (
+	// WhenPresent is active while the target exists, the default for
+	// streams.
+	WhenPresent DuckingWhen = "present"
+	// WhenUnmuted is active while the target exists and is not muted, the
+	// default for sinks and sources.
+	WhenUnmuted DuckingWhen = "unmuted"
+	// WhenActive is active while a source is being recorded from.
+	WhenActive DuckingWhen = "active"
+)
+
+// DuckingTrigger is written as the id of a target, or as a mapping with the
+// target and when it is active.
+type DuckingTrigger struct {
+	Target string      `yaml:"target"`
+	When   DuckingWhen `yaml:"when,omitempty"`
+}
+
+func (t *DuckingTrigger) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*t = DuckingTrigger{}
+		return value.Decode(&t.Target)
+	}
+
+	type plain DuckingTrigger
+	return value.Decode((*plain)(t))
+}
+
+// GestureConfig has the timings of gestures.
+type GestureConfig struct {
+	// DoubleTap is the longest time between two taps of a double tap. A
+	// tap is reported when no second tap follows within this time.
+	DoubleTap time.Duration `yaml:"doubleTap,omitempty"`
+	// LongPress is how long a button is held for a long press.
+	LongPress time.Duration `yaml:"longPress,omitempty"`
+	// RepeatInterval is the time between repeats while a button is held
+	// after a long press.
+	RepeatInterval time.Duration `yaml:"repeatInterval,omitempty"`
+}
+
+// LedHost is a LED host in a group. It is written as its name, or as a
+// mapping with offsets that are applied to everything sent to the host, and
+// a button that links the host to the group or unlinks it.
+type LedHost struct {
+	Host string `yaml:"host"`
+	// HueShift is added to the hue of colors, in degrees.
+	HueShift float64 `yaml:"hueShift,omitempty"`
+	// Brightness scales the brightness of colors. It defaults to 1.
+	Brightness float64  `yaml:"brightness,omitempty"`
+	Link       *Control `yaml:"link,omitempty"`
+}
+
+func (h *LedHost) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*h = LedHost{}
+		return value.Decode(&h.Host)
+	}
+
+	type plain LedHost
+	return value.Decode((*plain)(h))
 }
 
 type Action struct {
@@ -49,8 +219,16 @@ type Action struct {
 type Config struct {
 	Nats       NatsConfig       `yaml:"nats"`
 	Midi       MidiConfig       `yaml:"midi"`
+	Devices    []MidiConfig     `yaml:"devices"`
 	PulseAudio PulseAudioConfig `yaml:"pulseaudio"`
-	Actions    []Action         `yaml:"actions"`
+	Gestures   GestureConfig    `yaml:"gestures,omitempty"`
+	// Groups are named groups of LED hosts, that LED actions can control
+	// together.
+	Groups  map[string][]LedHost `yaml:"groups,omitempty"`
+	Actions []Action             `yaml:"actions"`
+
+	// File is the path the config was read from.
+	File string `yaml:"-"`
 }
 
 func Read(filename string) (*Config, error) {
@@ -59,11 +237,282 @@ func Read(filename string) (*Config, error) {
 		return nil, err
 	}
 
-	config := &Config{}
+	config := &Config{File: filename}
 	err = yaml.Unmarshal(data, &config)
 	if err != nil {
 		return nil, err
 	}
 
+	// A single device can be configured under "midi", multiple devices
+	// under "devices". The first device is the default for controls that
+	// don't name a device.
+	if len(config.Devices) != 0 && !reflect.ValueOf(config.Midi).IsZero() {
+		return nil, fmt.Errorf("configure either midi or devices")
+	}
+	if len(config.Devices) == 0 {
+		config.Devices = []MidiConfig{config.Midi}
+		if config.Devices[0].Name == "" {
+			config.Devices[0].Name = DefaultDevice
+		}
+	}
+
+	names := make(map[string]bool)
+	for i := range config.Devices {
+		device := &config.Devices[i]
+		if device.Name == "" {
+			return nil, fmt.Errorf("device %d: no name configured", i)
+		}
+		if names[device.Name] {
+			return nil, fmt.Errorf("device %s: configured twice", device.Name)
+		}
+		names[device.Name] = true
+
+		if device.MaxInputValue == nil {
+			max := uint(127)
+			device.MaxInputValue = &max
+		} else if *device.MaxInputValue == 0 {
+			return nil, fmt.Errorf("device %s: maxInputValue must be above 0", device.Name)
+		}
+
+		if device.ProfileName != "" {
+			device.Profile, err = profile.Load(device.ProfileName, filepath.Dir(filename))
+			if err != nil {
+				return nil, fmt.Errorf("device %s: %v", device.Name, err)
+			}
+		}
+	}
+
+	if config.Gestures.DoubleTap == 0 {
+		config.Gestures.DoubleTap = 300 * time.Millisecond
+	}
+	if config.Gestures.LongPress == 0 {
+		config.Gestures.LongPress = 600 * time.Millisecond
+	}
+	if config.Gestures.RepeatInterval == 0 {
+		config.Gestures.RepeatInterval = 150 * time.Millisecond
+	}
+
+	ids := make(map[string]bool)
+	for i := range config.PulseAudio.Targets {
+		target := &config.PulseAudio.Targets[i]
+		if target.Id == "" {
+			target.Id = targetId(target.Name)
+		}
+		// The id is a token of NATS subjects.
+		if target.Id == "" || strings.ContainsAny(target.Id, ".*>") || strings.IndexFunc(target.Id, unicode.IsSpace) >= 0 {
+			return nil, fmt.Errorf("target %s: id %q must not be empty, or contain '.', '*', '>' or whitespace", target.Name, target.Id)
+		}
+		if ids[target.Id] {
+			return nil, fmt.Errorf("target %s: id %s is used twice, configure a unique id", target.Name, target.Id)
+		}
+		ids[target.Id] = true
+
+		switch target.MuteMode {
+		case "":
+			target.MuteMode = MuteToggle
+		case MuteToggle, PushToTalk, PushToMute, MuteHybrid:
+		default:
+			return nil, fmt.Errorf("target %s: unknown mute mode %q", target.Name, target.MuteMode)
+		}
+
+		if err := config.resolveTarget(target); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range config.PulseAudio.Ducking {
+		if err := config.resolveDucking(&config.PulseAudio.Ducking[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, hosts := range config.Groups {
+		if err := config.resolveGroup(name, hosts); err != nil {
+			return nil, err
+		}
+	}
+
 	return config, nil
 }
+
+// ResolvedChannel returns the configured MIDI channel, or the channel of the
+// profile.
+func (m *MidiConfig) ResolvedChannel() uint8 {
+	if m.Channel != nil {
+		return *m.Channel
+	}
+	if m.Profile != nil {
+		return m.Profile.Channel
+	}
+	return 0
+}
+
+// targetId turns a target name into a NATS subject token.
+func targetId(name string) string {
+	id := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return '-'
+	}, name)
+	return strings.Trim(id, "-")
+}
+
+func (c *Config) target(id string) *PulseAudioTarget {
+	for i := range c.PulseAudio.Targets {
+		if c.PulseAudio.Targets[i].Id == id {
+			return &c.PulseAudio.Targets[i]
+		}
+	}
+	return nil
+}
+
+func (c *Config) resolveDucking(rule *DuckingRule) error {
+	if len(rule.Triggers) == 0 || len(rule.Targets) == 0 {
+		return fmt.Errorf("ducking %s: no triggers or targets configured", rule.Name)
+	}
+	if rule.Amount <= 0 {
+		return fmt.Errorf("ducking %s: amount must be positive", rule.Name)
+	}
+
+	if rule.Ramp == nil {
+		rule.Ramp = &transition.Config{Duration: 500 * time.Millisecond}
+	}
+	if err := rule.Ramp.Validate(); err != nil {
+		return fmt.Errorf("ducking %s: %v", rule.Name, err)
+	}
+
+	for i := range rule.Triggers {
+		trigger := &rule.Triggers[i]
+		target := c.target(trigger.Target)
+		if target == nil {
+			return fmt.Errorf("ducking %s: unknown trigger %s", rule.Name, trigger.Target)
+		}
+
+		stream := target.Type == PlaybackStream || target.Type == RecordStream
+		switch trigger.When {
+		case "":
+			trigger.When = WhenUnmuted
+			if stream {
+				trigger.When = WhenPresent
+			}
+		case WhenPresent, WhenUnmuted:
+		case WhenActive:
+			if target.Type != Source {
+				return fmt.Errorf("ducking %s: trigger %s: only a source can be active", rule.Name, trigger.Target)
+			}
+		default:
+			return fmt.Errorf("ducking %s: trigger %s: unknown when %q", rule.Name, trigger.Target, trigger.When)
+		}
+		if target.Type == Card && trigger.When != WhenPresent {
+			return fmt.Errorf("ducking %s: trigger %s: a card can only be present", rule.Name, trigger.Target)
+		}
+	}
+
+	for _, id := range rule.Targets {
+		target := c.target(id)
+		if target == nil {
+			return fmt.Errorf("ducking %s: unknown target %s", rule.Name, id)
+		}
+		if target.Type == Card {
+			return fmt.Errorf("ducking %s: a card has no volume to duck", rule.Name)
+		}
+	}
+	return nil
+}
+
+func (c *Config) resolveGroup(name string, hosts []LedHost) error {
+	if len(hosts) == 0 {
+		return fmt.Errorf("group %s: no hosts configured", name)
+	}
+
+	seen := make(map[string]bool)
+	for i := range hosts {
+		host := &hosts[i]
+		if host.Host == "" {
+			return fmt.Errorf("group %s: host %d has no name", name, i)
+		}
+		if seen[host.Host] {
+			return fmt.Errorf("group %s: host %s is configured twice", name, host.Host)
+		}
+		seen[host.Host] = true
+
+		if host.Brightness == 0 {
+			host.Brightness = 1
+		} else if host.Brightness < 0 {
+			return fmt.Errorf("group %s: host %s: brightness must be positive", name, host.Host)
+		}
+		if host.Link != nil {
+			if err := c.Resolve(host.Link); err != nil {
+				return fmt.Errorf("group %s: host %s: %v", name, host.Host, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) resolveTarget(target *PulseAudioTarget) error {
+	if target.Type == Card {
+		if target.Mute != nil || target.Default != nil || target.Volume != nil {
+			return fmt.Errorf("target %s: a card has no mute, default or volume", target.Name)
+		}
+	} else if target.Profile != nil || len(target.Profiles) != 0 {
+		return fmt.Errorf("target %s: only a card has profiles", target.Name)
+	}
+	if target.Profile != nil && len(target.Profiles) == 0 {
+		return fmt.Errorf("target %s: no profiles to cycle through", target.Name)
+	}
+	if target.Type != Sink && target.Type != Source && (target.Port != nil || len(target.Ports) != 0) {
+		return fmt.Errorf("target %s: only a sink or source has ports", target.Name)
+	}
+	if target.Port != nil && len(target.Ports) == 0 {
+		return fmt.Errorf("target %s: no ports to cycle through", target.Name)
+	}
+
+	if target.Type == Card && (target.Fade != nil || target.Glide != nil) {
+		return fmt.Errorf("target %s: a card has no volume to fade", target.Name)
+	}
+	if meter := target.Meter; meter != nil {
+		if target.Type == Card {
+			return fmt.Errorf("target %s: a card has no level to meter", target.Name)
+		}
+		if meter.Threshold == 0 {
+			meter.Threshold = -50
+		}
+		if meter.Clip == 0 {
+			meter.Clip = -0.5
+		}
+		if meter.Clip > 0 || meter.Threshold >= meter.Clip {
+			return fmt.Errorf("target %s: meter threshold must be below clip, which must be at most 0 dB", target.Name)
+		}
+	}
+	for _, t := range []*transition.Config{target.Fade, target.Glide} {
+		if t == nil {
+			continue
+		}
+		if err := t.Validate(); err != nil {
+			return fmt.Errorf("target %s: %v", target.Name, err)
+		}
+	}
+
+	controls := []*Control{target.Mute, target.Default, target.Presence, target.Volume, target.Profile, target.Port}
+	if target.Meter != nil {
+		controls = append(controls, target.Meter.Led)
+	}
+	for _, profile := range target.Profiles {
+		controls = append(controls, profile.Key)
+	}
+	for _, port := range target.Ports {
+		controls = append(controls, port.Key)
+	}
+
+	for _, control := range controls {
+		if control == nil {
+			continue
+		}
+		if err := c.Resolve(control); err != nil {
+			return fmt.Errorf("target %s: %v", target.Name, err)
+		}
+	}
+	return nil
+}
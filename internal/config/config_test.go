@@ -0,0 +1,74 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readString(t *testing.T, data string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return Read(path)
+}
+
+func TestMaxInputValue(t *testing.T) {
+	cfg, err := readString(t, "midi:\n  input: in\n  output: out\n")
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if max := *cfg.Devices[0].MaxInputValue; max != 127 {
+		t.Errorf("default maxInputValue is %d, want 127", max)
+	}
+
+	if _, err := readString(t, "midi:\n  input: in\n  output: out\n  maxInputValue: 0\n"); err == nil {
+		t.Error("maxInputValue 0 is accepted")
+	}
+}
+
+func TestMidiOrDevices(t *testing.T) {
+	devices := "devices:\n  - name: midimix\n    input: in\n    output: out\n"
+	if _, err := readString(t, devices); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if _, err := readString(t, "midi:\n  input: in\n  output: out\n"+devices); err == nil {
+		t.Error("both midi and devices are accepted")
+	}
+}
+
+func TestTargetId(t *testing.T) {
+	tests := []struct {
+		target string
+		id     string
+		ok     bool
+	}{
+		{"name: Jabra Link 380 Mono", "jabra-link-380-mono", true},
+		{"name: spotify\n    id: music", "music", true},
+		{"name: spotify\n    id: music.player", "", false},
+		{"name: spotify\n    id: \"*\"", "", false},
+		{"name: spotify\n    id: \"music>\"", "", false},
+		{"name: spotify\n    id: my music", "", false},
+		{"name: \"***\"", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			cfg, err := readString(t, "pulseaudio:\n  targets:\n  - type: Sink\n    "+test.target+"\n")
+			if !test.ok {
+				if err == nil {
+					t.Errorf("id %s is accepted", cfg.PulseAudio.Targets[0].Id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if id := cfg.PulseAudio.Targets[0].Id; id != test.id {
+				t.Errorf("id is %s, want %s", id, test.id)
+			}
+		})
+	}
+}
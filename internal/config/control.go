@@ -0,0 +1,187 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"gopkg.in/yaml.v3"
+)
+
+// Control is a MIDI key in the config. It is written either as a key number
+// (19) or as the name of a control in the controller profile (strip3.fader),
+// optionally prefixed with the device name (lights:strip1.knob2). Controls
+// without a device are on the first device. A button can be bound to a
+// gesture with a suffix (strip4.mute@longPress).
+type Control struct {
+	Device  string
+	Name    string
+	Key     uint8
+	Gesture Gesture
+}
+
+// Gesture is a way of pressing a button.
+type Gesture string
+
+const (
+	Tap       Gesture = "tap"
+	DoubleTap Gesture = "doubleTap"
+	LongPress Gesture = "longPress"
+	// Repeat is sent repeatedly while a button is held after a long press.
+	Repeat Gesture = "repeat"
+)
+
+// Is returns true if the control is key on device, and is not bound to a
+// gesture.
+func (c Control) Is(device string, key uint8) bool {
+	return c.Gesture == "" && c.On(device, key)
+}
+
+// IsGesture returns true if the control is bound to gesture of key on device.
+func (c Control) IsGesture(device string, key uint8, gesture Gesture) bool {
+	return c.Gesture == gesture && c.On(device, key)
+}
+
+// On returns true if the control is key on device, whether or not it is
+// bound to a gesture.
+func (c Control) On(device string, key uint8) bool {
+	return c.Device == device && c.Key == key
+}
+
+func (c Control) String() string {
+	value := c.Name
+	if value == "" {
+		value = strconv.Itoa(int(c.Key))
+	}
+	if c.Gesture != "" {
+		value += "@" + string(c.Gesture)
+	}
+	if c.Device != "" {
+		return c.Device + ":" + value
+	}
+	return value
+}
+
+func (c *Control) UnmarshalYAML(value *yaml.Node) error {
+	var key uint8
+	if err := value.Decode(&key); err == nil {
+		*c = Control{Key: key}
+		return nil
+	}
+
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return fmt.Errorf("line %d: control must be a key number or name", value.Line)
+	}
+	*c = parseName(s)
+	return nil
+}
+
+// parseName parses a control written as a string.
+func parseName(s string) Control {
+	c := Control{}
+	if device, name, ok := strings.Cut(s, ":"); ok {
+		c.Device = device
+		s = name
+	}
+	if name, gesture, ok := strings.Cut(s, "@"); ok {
+		c.Gesture = Gesture(gesture)
+		s = name
+	}
+
+	if key, err := strconv.ParseUint(s, 10, 7); err == nil {
+		c.Key = uint8(key)
+	} else {
+		c.Name = s
+	}
+	return c
+}
+
+// parseControl parses a control from a generic action config value.
+func parseControl(data interface{}) (Control, error) {
+	switch value := data.(type) {
+	case int:
+		if value < 0 || value > 127 {
+			return Control{}, fmt.Errorf("control %d out of range", value)
+		}
+		return Control{Key: uint8(value)}, nil
+	case string:
+		return parseName(value), nil
+	default:
+		return Control{}, fmt.Errorf("control must be a key number or name, got %v", data)
+	}
+}
+
+// Device returns the config of the named MIDI device, or of the first device
+// if name is empty.
+func (c *Config) Device(name string) (*MidiConfig, error) {
+	if name == "" {
+		return &c.Devices[0], nil
+	}
+	for i := range c.Devices {
+		if c.Devices[i].Name == name {
+			return &c.Devices[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown device %s", name)
+}
+
+// Resolve sets the device of a control, and looks up the key of a named
+// control in the profile of that device.
+func (c *Config) Resolve(control *Control) error {
+	switch control.Gesture {
+	case "", Tap, DoubleTap, LongPress, Repeat:
+	default:
+		return fmt.Errorf("control %s: unknown gesture %s", control, control.Gesture)
+	}
+
+	device, err := c.Device(control.Device)
+	if err != nil {
+		return fmt.Errorf("control %s: %v", control, err)
+	}
+	control.Device = device.Name
+	return device.Resolve(control)
+}
+
+// Resolve looks up the key of a named control in the profile.
+func (m *MidiConfig) Resolve(c *Control) error {
+	if c.Name == "" {
+		return nil
+	}
+
+	if m.Profile == nil {
+		return fmt.Errorf("control %s: no profile configured for device %s", c, m.Name)
+	}
+
+	control, ok := m.Profile.Lookup(c.Name)
+	if !ok {
+		return fmt.Errorf("control %s: not in profile %s", c, m.Profile.Name)
+	}
+
+	c.Key = control.Number
+	return nil
+}
+
+// ControlHook is a mapstructure decode hook that decodes and resolves
+// controls in action configs.
+func (c *Config) ControlHook() mapstructure.DecodeHookFuncType {
+	controlType := reflect.TypeOf(Control{})
+	return func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+		if to != controlType {
+			return data, nil
+		}
+
+		control, err := parseControl(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.Resolve(&control); err != nil {
+			return nil, err
+		}
+
+		return control, nil
+	}
+}
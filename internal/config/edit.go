@@ -0,0 +1,206 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SetControl writes a control into the config file at path. The path is a dot
+// separated list of mapping keys and sequence items, where a sequence item
+// is selected by its index or by the value of its "name" field. For example:
+//
+//	pulseaudio.targets.spotify.mute
+//	actions.2.config.controls.1
+//
+// Only the value itself is rewritten (or a single line inserted when the
+// field does not exist yet), so comments and layout are kept intact.
+func SetControl(filename string, path string, value string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+
+	data, err = setValue(data, path, value)
+	if err != nil {
+		return err
+	}
+
+	// Never leave a config behind that can't be read anymore.
+	var check yaml.Node
+	if err := yaml.Unmarshal(data, &check); err != nil {
+		return fmt.Errorf("%s: edit would break the config: %v", path, err)
+	}
+
+	return os.WriteFile(filename, data, info.Mode())
+}
+
+func setValue(data []byte, path string, value string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil, fmt.Errorf("empty config")
+	}
+
+	segments := strings.Split(path, ".")
+	node := doc.Content[0]
+	for i, segment := range segments {
+		last := i == len(segments)-1
+
+		switch node.Kind {
+		case yaml.MappingNode:
+			child := mappingValue(node, segment)
+			if child == nil {
+				if !last {
+					return nil, fmt.Errorf("%s: not found", strings.Join(segments[:i+1], "."))
+				}
+				return insertKey(data, node, segment, value)
+			}
+			node = child
+
+		case yaml.SequenceNode:
+			child := sequenceItem(node, segment)
+			if child == nil {
+				return nil, fmt.Errorf("%s: not found", strings.Join(segments[:i+1], "."))
+			}
+			node = child
+
+		default:
+			return nil, fmt.Errorf("%s: not a mapping or sequence", strings.Join(segments[:i], "."))
+		}
+	}
+
+	if node.Kind != yaml.ScalarNode {
+		return nil, fmt.Errorf("%s: not a scalar", path)
+	}
+
+	return replaceScalar(data, node, keepGesture(node.Value, value))
+}
+
+// keepGesture keeps the gesture of the control that is replaced, unless the
+// new control has one itself. Learning a button over "strip4.mute@longPress"
+// gives "strip4.rec@longPress".
+func keepGesture(old string, value string) string {
+	if strings.Contains(value, "@") {
+		return value
+	}
+	if i := strings.LastIndex(old, "@"); i >= 0 {
+		return value + old[i:]
+	}
+	return value
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func sequenceItem(node *yaml.Node, segment string) *yaml.Node {
+	if index, err := strconv.Atoi(segment); err == nil {
+		if index < 0 || index >= len(node.Content) {
+			return nil
+		}
+		return node.Content[index]
+	}
+
+	for _, item := range node.Content {
+		if item.Kind != yaml.MappingNode {
+			continue
+		}
+		if name := mappingValue(item, "name"); name != nil && name.Value == segment {
+			return item
+		}
+	}
+
+	return nil
+}
+
+// offset returns the byte offset of a 1-based line and column.
+func offset(data []byte, line, column int) (int, error) {
+	pos := 0
+	for l := 1; l < line; l++ {
+		i := bytes.IndexByte(data[pos:], '\n')
+		if i < 0 {
+			return 0, fmt.Errorf("line %d out of range", line)
+		}
+		pos += i + 1
+	}
+	return pos + column - 1, nil
+}
+
+func replaceScalar(data []byte, node *yaml.Node, value string) ([]byte, error) {
+	start, err := offset(data, node.Line, node.Column)
+	if err != nil {
+		return nil, err
+	}
+
+	end := start
+	switch node.Style {
+	case yaml.DoubleQuotedStyle, yaml.SingleQuotedStyle:
+		quote := data[start]
+		end = start + 1
+		for end < len(data) && data[end] != quote {
+			if quote == '"' && data[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		end++
+	case 0:
+		end = start + len(node.Value)
+		// An empty value, as in "mute:", starts right after the colon.
+		if node.Value == "" && start > 0 && data[start-1] == ':' {
+			value = " " + value
+		}
+	default:
+		return nil, fmt.Errorf("line %d: unsupported scalar style", node.Line)
+	}
+
+	if end > len(data) {
+		return nil, fmt.Errorf("line %d: unterminated scalar", node.Line)
+	}
+
+	out := make([]byte, 0, len(data)+len(value))
+	out = append(out, data[:start]...)
+	out = append(out, value...)
+	out = append(out, data[end:]...)
+	return out, nil
+}
+
+// insertKey adds "key: value" as the first entry of a block mapping. The
+// mapping starts at the column of its first key, also when that key follows
+// the dash of a sequence item, so the entry is inserted right there and the
+// first key moves to the next line with the same indentation.
+func insertKey(data []byte, node *yaml.Node, key string, value string) ([]byte, error) {
+	if node.Style&yaml.FlowStyle != 0 || len(node.Content) < 2 {
+		return nil, fmt.Errorf("line %d: cannot insert %s into this mapping", node.Line, key)
+	}
+
+	start, err := offset(data, node.Line, node.Column)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := fmt.Sprintf("%s: %s\n%s", key, value, strings.Repeat(" ", node.Column-1))
+
+	out := make([]byte, 0, len(data)+len(entry))
+	out = append(out, data[:start]...)
+	out = append(out, entry...)
+	out = append(out, data[start:]...)
+	return out, nil
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSetValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		path  string
+		value string
+		want  string
+	}{
+		{
+			name:  "empty value",
+			data:  "targets:\n  - name: spotify\n    mute:\n",
+			path:  "targets.spotify.mute",
+			value: "strip1.mute",
+			want:  "targets:\n  - name: spotify\n    mute: strip1.mute\n",
+		},
+		{
+			name:  "plain scalar",
+			data:  "targets:\n  - name: spotify\n    mute: strip1.mute # button\n",
+			path:  "targets.0.mute",
+			value: "lights:strip2.mute",
+			want:  "targets:\n  - name: spotify\n    mute: lights:strip2.mute # button\n",
+		},
+		{
+			name:  "quoted scalar",
+			data:  "targets:\n  - name: spotify\n    volume: \"strip1.fader\"\n",
+			path:  "targets.spotify.volume",
+			value: "strip2.fader",
+			want:  "targets:\n  - name: spotify\n    volume: strip2.fader\n",
+		},
+		{
+			name:  "flow sequence",
+			data:  "actions:\n  - type: LedColor\n    config:\n      controls: [strip1.knob1, strip1.knob2]\n",
+			path:  "actions.0.config.controls.1",
+			value: "strip3.knob2",
+			want:  "actions:\n  - type: LedColor\n    config:\n      controls: [strip1.knob1, strip3.knob2]\n",
+		},
+		{
+			name:  "insert into nested mapping",
+			data:  "actions:\n  - type: LedColor\n    config:\n      controls: [strip1.knob1, strip1.knob2]\n      format: hsv\n",
+			path:  "actions.0.config.brightness",
+			value: "strip1.fader",
+			want:  "actions:\n  - type: LedColor\n    config:\n      brightness: strip1.fader\n      controls: [strip1.knob1, strip1.knob2]\n      format: hsv\n",
+		},
+		{
+			name:  "insert into sequence item",
+			data:  "targets:\n  - name: spotify\n    volume: strip1.fader\n",
+			path:  "targets.spotify.mute",
+			value: "strip1.mute",
+			want:  "targets:\n  - mute: strip1.mute\n    name: spotify\n    volume: strip1.fader\n",
+		},
+		{
+			name:  "gesture suffix",
+			data:  "targets:\n  - name: spotify\n    mute: strip4.mute@longPress\n",
+			path:  "targets.spotify.mute",
+			value: "strip4.rec",
+			want:  "targets:\n  - name: spotify\n    mute: strip4.rec@longPress\n",
+		},
+		{
+			name:  "new gesture",
+			data:  "targets:\n  - name: spotify\n    mute: strip4.mute@longPress\n",
+			path:  "targets.spotify.mute",
+			value: "strip4.rec@doubleTap",
+			want:  "targets:\n  - name: spotify\n    mute: strip4.rec@doubleTap\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := setValue([]byte(test.data), test.path, test.value)
+			if err != nil {
+				t.Fatalf("setValue: %v", err)
+			}
+			if string(out) != test.want {
+				t.Errorf("got:\n%s\nwant:\n%s", out, test.want)
+			}
+
+			var doc yaml.Node
+			if err := yaml.Unmarshal(out, &doc); err != nil {
+				t.Errorf("output does not parse: %v", err)
+			}
+		})
+	}
+}
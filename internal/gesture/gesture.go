@@ -0,0 +1,155 @@
+package gesture
+
+import (
+	"sync"
+	"time"
+
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/midiclient"
+)
+
+type button struct {
+	device string
+	key    uint8
+}
+
+type state struct {
+	held bool
+	long bool
+	taps int
+	// gen is increased on every press and release, so a timer that fires
+	// after the button changed knows it is stale.
+	gen   uint64
+	timer *time.Timer
+}
+
+// Detector turns the presses and releases of buttons into gestures. A double
+// tap is reported when the button is released the second time. Taps, long
+// presses and repeats are reported later, on the Events channel.
+type Detector struct {
+	cfg     config.GestureConfig
+	mu      sync.Mutex
+	buttons map[button]*state
+	events  chan midiclient.MidiGesture
+	done    chan struct{}
+}
+
+func New(cfg config.GestureConfig) *Detector {
+	return &Detector{
+		cfg:     cfg,
+		buttons: make(map[button]*state),
+		events:  make(chan midiclient.MidiGesture),
+		done:    make(chan struct{}),
+	}
+}
+
+// Events returns the channel gestures that are detected by a timer are
+// sent on.
+func (d *Detector) Events() <-chan midiclient.MidiGesture {
+	return d.events
+}
+
+// Close stops all timers.
+func (d *Detector) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	close(d.done)
+	for _, s := range d.buttons {
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+	}
+}
+
+// Offer hands a MIDI message to the detector. It returns a gesture if the
+// message completes one right away.
+func (d *Detector) Offer(msg midiclient.MidiMessage) (midiclient.MidiGesture, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch msg := msg.(type) {
+	case midiclient.MidiNoteOn:
+		b := button{msg.Device, msg.Key}
+		s := d.get(b)
+		s.held = true
+		s.long = false
+		d.schedule(b, s, d.cfg.LongPress, d.longPress)
+
+	case midiclient.MidiNoteOff:
+		b := button{msg.Device, msg.Key}
+		s := d.get(b)
+		s.held = false
+		d.schedule(b, s, 0, nil)
+		if s.long {
+			break
+		}
+
+		s.taps++
+		if s.taps == 2 {
+			s.taps = 0
+			return midiclient.MidiGesture{Device: b.device, Key: b.key, Gesture: config.DoubleTap}, true
+		}
+		d.schedule(b, s, d.cfg.DoubleTap, d.tap)
+	}
+
+	return midiclient.MidiGesture{}, false
+}
+
+func (d *Detector) get(b button) *state {
+	s, ok := d.buttons[b]
+	if !ok {
+		s = &state{}
+		d.buttons[b] = s
+	}
+	return s
+}
+
+// schedule replaces the timer of a button with one that calls f after a
+// while, or stops it when f is nil. Must be called with the lock held.
+func (d *Detector) schedule(b button, s *state, after time.Duration, f func(button, *state) config.Gesture) {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.gen++
+	if f == nil {
+		return
+	}
+
+	gen := s.gen
+	s.timer = time.AfterFunc(after, func() {
+		d.mu.Lock()
+		if s.gen != gen {
+			d.mu.Unlock()
+			return
+		}
+		gesture := f(b, s)
+		d.mu.Unlock()
+
+		select {
+		case d.events <- midiclient.MidiGesture{Device: b.device, Key: b.key, Gesture: gesture}:
+		case <-d.done:
+		}
+	})
+}
+
+// tap reports a tap when no second tap followed.
+func (d *Detector) tap(b button, s *state) config.Gesture {
+	s.taps = 0
+	return config.Tap
+}
+
+// longPress reports a long press, and starts repeating while the button is
+// held.
+func (d *Detector) longPress(b button, s *state) config.Gesture {
+	s.long = true
+	s.taps = 0
+	d.schedule(b, s, d.cfg.RepeatInterval, d.repeat)
+	return config.LongPress
+}
+
+func (d *Detector) repeat(b button, s *state) config.Gesture {
+	d.schedule(b, s, d.cfg.RepeatInterval, d.repeat)
+	return config.Repeat
+}
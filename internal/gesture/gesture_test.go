@@ -0,0 +1,125 @@
+package gesture
+
+import (
+	"testing"
+	"time"
+
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/midiclient"
+)
+
+var testConfig = config.GestureConfig{
+	DoubleTap:      50 * time.Millisecond,
+	LongPress:      100 * time.Millisecond,
+	RepeatInterval: 30 * time.Millisecond,
+}
+
+var (
+	press   = midiclient.MidiNoteOn{Device: "midimix", Key: 1, Velocity: 1}
+	release = midiclient.MidiNoteOff{Device: "midimix", Key: 1}
+)
+
+// expect waits for the next gesture on the Events channel.
+func expect(t *testing.T, d *Detector, want config.Gesture) {
+	t.Helper()
+	select {
+	case got := <-d.Events():
+		if got.Gesture != want || got.Device != press.Device || got.Key != press.Key {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no %v", want)
+	}
+}
+
+// expectNone checks that no gesture is sent for a while.
+func expectNone(t *testing.T, d *Detector, wait time.Duration) {
+	t.Helper()
+	select {
+	case got := <-d.Events():
+		t.Fatalf("unexpected %v", got)
+	case <-time.After(wait):
+	}
+}
+
+// offer offers msg, and checks that it does not complete a gesture.
+func offer(t *testing.T, d *Detector, msg midiclient.MidiMessage) {
+	t.Helper()
+	if got, ok := d.Offer(msg); ok {
+		t.Fatalf("unexpected %v", got)
+	}
+}
+
+func TestTap(t *testing.T) {
+	d := New(testConfig)
+	defer d.Close()
+
+	offer(t, d, press)
+	offer(t, d, release)
+	expect(t, d, config.Tap)
+	expectNone(t, d, 2*testConfig.LongPress)
+}
+
+func TestDoubleTap(t *testing.T) {
+	d := New(testConfig)
+	defer d.Close()
+
+	offer(t, d, press)
+	offer(t, d, release)
+	offer(t, d, press)
+	got, ok := d.Offer(release)
+	if !ok || got.Gesture != config.DoubleTap {
+		t.Fatalf("got %v, %v, want %v", got, ok, config.DoubleTap)
+	}
+	expectNone(t, d, 2*testConfig.LongPress)
+}
+
+func TestTapsTooFarApart(t *testing.T) {
+	d := New(testConfig)
+	defer d.Close()
+
+	offer(t, d, press)
+	offer(t, d, release)
+	expect(t, d, config.Tap)
+	offer(t, d, press)
+	offer(t, d, release)
+	expect(t, d, config.Tap)
+}
+
+func TestLongPressRepeat(t *testing.T) {
+	d := New(testConfig)
+	defer d.Close()
+
+	offer(t, d, press)
+	expect(t, d, config.LongPress)
+	expect(t, d, config.Repeat)
+	expect(t, d, config.Repeat)
+
+	// Releasing after a long press is not a tap, and stops the repeats.
+	offer(t, d, release)
+	expectNone(t, d, 2*testConfig.LongPress)
+}
+
+func TestOtherButton(t *testing.T) {
+	d := New(testConfig)
+	defer d.Close()
+
+	// A tap on another button does not make a double tap.
+	offer(t, d, press)
+	offer(t, d, release)
+	offer(t, d, midiclient.MidiNoteOn{Device: "midimix", Key: 2, Velocity: 1})
+	offer(t, d, midiclient.MidiNoteOff{Device: "midimix", Key: 2})
+
+	got := map[uint8]config.Gesture{}
+	for i := 0; i < 2; i++ {
+		select {
+		case g := <-d.Events():
+			got[g.Key] = g.Gesture
+		case <-time.After(time.Second):
+			t.Fatalf("got %v, want two taps", got)
+		}
+	}
+	if got[1] != config.Tap || got[2] != config.Tap {
+		t.Fatalf("got %v, want two taps", got)
+	}
+}
@@ -0,0 +1,168 @@
+package learn
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/leds"
+	"github.com/c0deaddict/midimix/internal/midiclient"
+	"github.com/c0deaddict/midimix/internal/monitor"
+)
+
+// Time to ignore input after a control was captured, so the tail of a fader
+// movement or the release of a button is not captured for the next field.
+const settleTime = 500 * time.Millisecond
+
+// Learner captures the next touched control from a stream of MIDI messages.
+// A captured button blinks on the alert layer, to confirm it was learned.
+type Learner struct {
+	cfg     *config.Config
+	alert   *leds.Layer
+	mu      sync.Mutex
+	pending chan result
+	settle  time.Time
+}
+
+// result is a captured control as written in the config, or why the touched
+// control cannot be learned.
+type result struct {
+	value string
+	err   error
+}
+
+func New(cfg *config.Config, engine *leds.Engine) *Learner {
+	return &Learner{cfg: cfg, alert: engine.Layer("learn", leds.Alert)}
+}
+
+// Close turns off the LED of a button that was just captured.
+func (l *Learner) Close() {
+	l.alert.ReleaseAll(monitor.Cause{})
+}
+
+// Offer hands a MIDI message to the learner. It returns true if the message
+// was consumed by learn mode and should not be dispatched any further.
+func (l *Learner) Offer(msg midiclient.MidiMessage) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if time.Now().Before(l.settle) {
+		return true
+	}
+
+	if l.pending == nil {
+		return false
+	}
+
+	if value, ok, err := l.value(msg); ok {
+		l.pending <- result{value, err}
+		l.pending = nil
+		l.settle = time.Now().Add(settleTime)
+		if msg, ok := msg.(midiclient.MidiNoteOn); ok && err == nil {
+			control := config.Control{Device: msg.Device, Key: msg.Key}
+			l.alert.Flash(monitor.Cause{}.By("learn"), control, leds.FastBlink, settleTime)
+		}
+	}
+
+	return true
+}
+
+// value returns how the control that produced msg is written in the config:
+// its name in the profile of the device it is on, or else its key number.
+// Controls on other than the first device are prefixed with the device name.
+// It returns false if msg is not from touching a control. Pitch bend faders
+// have no key, unless a profile gives them one, so they cannot be learned.
+func (l *Learner) value(msg midiclient.MidiMessage) (string, bool, error) {
+	if msg, ok := msg.(midiclient.MidiPitchBend); ok {
+		return "", true, fmt.Errorf("pitch bend on channel %d of %s has no key, describe it in a profile with type pitchbend", msg.Channel, msg.Device)
+	}
+
+	device, key, ok := Key(msg)
+	if !ok {
+		return "", false, nil
+	}
+
+	deviceCfg, err := l.cfg.Device(device)
+	if err != nil {
+		return "", true, err
+	}
+
+	control := config.Control{Key: key}
+	if deviceCfg != &l.cfg.Devices[0] {
+		control.Device = deviceCfg.Name
+	}
+
+	if deviceCfg.Profile != nil {
+		_, button := msg.(midiclient.MidiNoteOn)
+		if name, ok := deviceCfg.Profile.Find(button, key); ok {
+			control.Name = name
+		}
+	}
+
+	return control.String(), true, nil
+}
+
+// Next waits for the next touched control and returns it as written in the
+// config.
+func (l *Learner) Next(timeout time.Duration) (string, error) {
+	ch := make(chan result, 1)
+
+	l.mu.Lock()
+	if l.pending != nil {
+		l.mu.Unlock()
+		return "", fmt.Errorf("already learning")
+	}
+	l.pending = ch
+	l.mu.Unlock()
+
+	select {
+	case r := <-ch:
+		return r.value, r.err
+	case <-time.After(timeout):
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.pending == ch {
+			l.pending = nil
+		}
+		// The key might have been captured right before the lock was taken.
+		select {
+		case r := <-ch:
+			return r.value, r.err
+		default:
+			return "", fmt.Errorf("timeout waiting for a control")
+		}
+	}
+}
+
+// Learn waits for the next touched control and writes it into the config
+// file at path.
+func (l *Learner) Learn(filename string, path string, timeout time.Duration) (string, error) {
+	log.Info().Msgf("learn: touch the control for %s", path)
+	value, err := l.Next(timeout)
+	if err != nil {
+		return "", err
+	}
+
+	if err := config.SetControl(filename, path, value); err != nil {
+		return "", err
+	}
+
+	log.Info().Msgf("learn: set %s to %s", path, value)
+	return value, nil
+}
+
+// Key returns the device and key of the control that produced msg. Only
+// messages from touching a control count; releases are ignored.
+func Key(msg midiclient.MidiMessage) (string, uint8, bool) {
+	switch msg := msg.(type) {
+	case midiclient.MidiNoteOn:
+		return msg.Device, msg.Key, true
+	case midiclient.MidiControlChange:
+		return msg.Device, msg.Key, true
+	default:
+		return "", 0, false
+	}
+}
@@ -0,0 +1,39 @@
+package learn
+
+import (
+	"testing"
+
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/midiclient"
+)
+
+func TestValue(t *testing.T) {
+	l := &Learner{cfg: &config.Config{Devices: []config.MidiConfig{{Name: "midimix"}, {Name: "xtouch"}}}}
+
+	tests := []struct {
+		name  string
+		msg   midiclient.MidiMessage
+		want  string
+		ok    bool
+		fails bool
+	}{
+		{"button", midiclient.MidiNoteOn{Device: "midimix", Key: 3, Velocity: 1}, "3", true, false},
+		{"knob", midiclient.MidiControlChange{Device: "midimix", Key: 16, Value: 0.5}, "16", true, false},
+		{"second device", midiclient.MidiNoteOn{Device: "xtouch", Key: 8, Velocity: 1}, "xtouch:8", true, false},
+		{"unknown device", midiclient.MidiNoteOn{Device: "launchpad", Key: 8, Velocity: 1}, "", true, true},
+		{"pitch bend", midiclient.MidiPitchBend{Device: "xtouch", Channel: 1, Value: 0.5}, "", true, true},
+		{"release", midiclient.MidiNoteOff{Device: "midimix", Key: 3}, "", false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok, err := l.value(test.msg)
+			if ok != test.ok || (err != nil) != test.fails {
+				t.Fatalf("got ok %v, error %v, want ok %v, error %v", ok, err, test.ok, test.fails)
+			}
+			if got != test.want {
+				t.Fatalf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package leds
+
+import (
+	"sort"
+	"time"
+
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/monitor"
+)
+
+type Priority int
+
+const (
+	// Background is for state that is always shown, such as the state of
+	// PulseAudio targets.
+	Background Priority = 0
+	// Normal is for actions.
+	Normal Priority = 10
+	// Overlay is for temporary displays that hide the state underneath,
+	// such as bargraphs.
+	Overlay Priority = 20
+	// Alert is for errors and learn mode.
+	Alert Priority = 30
+)
+
+// Layer is a producer of LED state. When a layer releases an LED, the LED
+// shows the layer underneath again.
+type Layer struct {
+	engine   *Engine
+	name     string
+	priority Priority
+}
+
+// Layer returns a new layer with the given priority.
+func (e *Engine) Layer(name string, priority Priority) *Layer {
+	return &Layer{engine: e, name: name, priority: priority}
+}
+
+func (l *Layer) String() string {
+	return l.name
+}
+
+// Set claims an LED and sets its pattern. The change is shown in the
+// monitor with its cause.
+func (l *Layer) Set(cause monitor.Cause, c config.Control, pattern Pattern) {
+	e := l.engine
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cl := e.claim(l, c)
+	cl.pattern = pattern
+	cl.claimed = true
+	e.update(time.Now(), cause, led{c.Device, c.Key})
+}
+
+// SetLed claims an LED and turns it on or off.
+func (l *Layer) SetLed(cause monitor.Cause, c config.Control, state bool) {
+	if state {
+		l.Set(cause, c, On)
+	} else {
+		l.Set(cause, c, Off)
+	}
+}
+
+// Flash shows pattern on an LED for duration, after which the LED returns to
+// the pattern set by this layer, or is released if it had none. A one-shot
+// flash is Flash(c, On, 100*time.Millisecond).
+func (l *Layer) Flash(cause monitor.Cause, c config.Control, pattern Pattern, duration time.Duration) {
+	e := l.engine
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cl := e.claim(l, c)
+	cl.flash = pattern
+	cl.until = time.Now().Add(duration)
+	e.update(time.Now(), cause, led{c.Device, c.Key})
+}
+
+// Release gives up the claim on an LED.
+func (l *Layer) Release(cause monitor.Cause, c config.Control) {
+	e := l.engine
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := led{c.Device, c.Key}
+	e.release(l, key)
+	e.update(time.Now(), cause, key)
+}
+
+// ReleaseAll gives up the claims on all LEDs.
+func (l *Layer) ReleaseAll(cause monitor.Cause) {
+	e := l.engine
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	released := make([]led, 0)
+	for key := range e.leds {
+		if e.release(l, key) {
+			released = append(released, key)
+		}
+	}
+	e.update(time.Now(), cause, released...)
+}
+
+// Shadow is what an LED should show, and which layer decided it.
+type Shadow struct {
+	Control string  `json:"control"`
+	Pattern Pattern `json:"pattern"`
+	Owner   string  `json:"owner,omitempty"`
+}
+
+// Shadow returns what every known LED should show, sorted by control.
+func (e *Engine) Shadow() []Shadow {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	shadow := make([]Shadow, 0, len(e.leds))
+	for _, s := range e.leds {
+		owner := ""
+		if s.owner != nil {
+			owner = s.owner.name
+		}
+		shadow = append(shadow, Shadow{s.control.String(), s.pattern, owner})
+	}
+
+	sort.Slice(shadow, func(i, j int) bool {
+		return shadow[i].Control < shadow[j].Control
+	})
+	return shadow
+}
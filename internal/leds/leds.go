@@ -0,0 +1,241 @@
+package leds
+
+import (
+	"sync"
+	"time"
+
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/midiclient"
+	"github.com/c0deaddict/midimix/internal/monitor"
+)
+
+type Pattern int
+
+const (
+	Off Pattern = iota
+	On
+	Blink
+	FastBlink
+	Pulse
+)
+
+const (
+	tick            = 20 * time.Millisecond
+	blinkPeriod     = 1 * time.Second
+	fastBlinkPeriod = 250 * time.Millisecond
+	// Pulse lights an LED briefly once per period, like a heartbeat. LEDs
+	// are only on or off, and dimming them in software would send a MIDI
+	// message on every toggle.
+	pulsePeriod = 2 * time.Second
+	pulseWidth  = 150 * time.Millisecond
+)
+
+// led identifies an LED. Controls can name the same LED by name or by key,
+// so only the device and key are used.
+type led struct {
+	device string
+	key    uint8
+}
+
+// claim is the pattern a layer wants to show on an LED. A flash is shown
+// instead of the pattern until it expires.
+type claim struct {
+	pattern Pattern
+	claimed bool
+	flash   Pattern
+	until   time.Time
+	seq     uint64
+}
+
+type state struct {
+	control config.Control
+	claims  map[*Layer]*claim
+	// pattern and owner are what the LED should show, see compose.
+	pattern Pattern
+	owner   *Layer
+}
+
+// Engine drives the LEDs with patterns from a single timer loop, and only
+// sends LED changes to the devices. LEDs are claimed by layers, and the
+// layer with the highest priority decides what an LED shows.
+type Engine struct {
+	midi  *midiclient.Devices
+	trace *monitor.Tracer
+	mu    sync.Mutex
+	leds  map[led]*state
+	shown map[led]bool
+	seq   uint64
+	start time.Time
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func New(midi *midiclient.Devices, trace *monitor.Tracer) *Engine {
+	e := &Engine{
+		midi:  midi,
+		trace: trace,
+		leds:  make(map[led]*state),
+		shown: make(map[led]bool),
+		start: time.Now(),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// Close stops the timer loop, after sending the last changes.
+func (e *Engine) Close() {
+	close(e.stop)
+	<-e.done
+}
+
+func (e *Engine) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.mu.Lock()
+			e.update(time.Now(), monitor.Cause{})
+			e.mu.Unlock()
+		case <-e.stop:
+			e.mu.Lock()
+			e.update(time.Now(), monitor.Cause{})
+			e.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (e *Engine) get(c config.Control) *state {
+	l := led{c.Device, c.Key}
+	s, ok := e.leds[l]
+	if !ok {
+		s = &state{control: c, claims: make(map[*Layer]*claim)}
+		e.leds[l] = s
+	}
+	return s
+}
+
+// claim returns the claim of layer on an LED. Must be called with the lock
+// held.
+func (e *Engine) claim(layer *Layer, c config.Control) *claim {
+	s := e.get(c)
+	cl, ok := s.claims[layer]
+	if !ok {
+		cl = &claim{}
+		s.claims[layer] = cl
+	}
+	e.seq++
+	cl.seq = e.seq
+	return cl
+}
+
+// release drops the claim of layer on an LED, and returns true if it had
+// one. Must be called with the lock held.
+func (e *Engine) release(layer *Layer, l led) bool {
+	s, ok := e.leds[l]
+	if !ok {
+		return false
+	}
+	_, claimed := s.claims[layer]
+	delete(s.claims, layer)
+	return claimed
+}
+
+// compose picks the claim that decides what an LED shows: the one of the
+// layer with the highest priority, or the most recent one when priorities
+// are equal. Expired flashes and released claims are dropped on the way.
+func (s *state) compose(now time.Time) {
+	s.pattern = Off
+	s.owner = nil
+
+	var top *claim
+	for layer, cl := range s.claims {
+		flashing := now.Before(cl.until)
+		if !flashing && !cl.claimed {
+			delete(s.claims, layer)
+			continue
+		}
+
+		if top == nil || layer.priority > s.owner.priority ||
+			(layer.priority == s.owner.priority && cl.seq > top.seq) {
+			top = cl
+			s.owner = layer
+			s.pattern = cl.pattern
+			if flashing {
+				s.pattern = cl.flash
+			}
+		}
+	}
+}
+
+// update sends the LEDs whose state changed. Changes of the touched LEDs
+// are shown in the monitor with cause, the others, e.g. blinks, are
+// attributed to the layer that shows them. Must be called with the lock
+// held.
+func (e *Engine) update(now time.Time, cause monitor.Cause, touched ...led) {
+	elapsed := now.Sub(e.start)
+	for l, s := range e.leds {
+		s.compose(now)
+
+		on := s.pattern.at(elapsed)
+		if shown, ok := e.shown[l]; ok && shown == on {
+			continue
+		}
+		e.shown[l] = on
+		e.midi.SetLed(s.control, on, e.causeOf(l, s, cause, touched))
+	}
+}
+
+// causeOf returns the cause of a change of LED l.
+func (e *Engine) causeOf(l led, s *state, cause monitor.Cause, touched []led) monitor.Cause {
+	for _, t := range touched {
+		if t == l {
+			return cause
+		}
+	}
+	if s.owner != nil {
+		return monitor.Cause{}.By(s.owner.name)
+	}
+	return monitor.Cause{}
+}
+
+// at returns if a pattern is on at elapsed time since the engine started.
+func (p Pattern) at(elapsed time.Duration) bool {
+	switch p {
+	case On:
+		return true
+	case Blink:
+		return elapsed%blinkPeriod < blinkPeriod/2
+	case FastBlink:
+		return elapsed%fastBlinkPeriod < fastBlinkPeriod/2
+	case Pulse:
+		return elapsed%pulsePeriod < pulseWidth
+	default:
+		return false
+	}
+}
+
+func (p Pattern) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p Pattern) String() string {
+	switch p {
+	case On:
+		return "on"
+	case Blink:
+		return "blink"
+	case FastBlink:
+		return "fastBlink"
+	case Pulse:
+		return "pulse"
+	default:
+		return "off"
+	}
+}
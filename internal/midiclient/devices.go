@@ -0,0 +1,86 @@
+package midiclient
+
+import (
+	"github.com/mitchellh/mapstructure"
+	"github.com/rs/zerolog/log"
+	"gitlab.com/gomidi/midi/v2"
+
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/monitor"
+)
+
+// Devices are all MIDI controllers, sharing one message stream. Controls
+// name the device they are on, so LEDs are sent to the right device.
+type Devices struct {
+	cfg     *config.Config
+	devices []*MidiClient
+}
+
+func OpenAll(cfg *config.Config, trace *monitor.Tracer) (*Devices, error) {
+	d := &Devices{cfg: cfg}
+	for _, deviceCfg := range cfg.Devices {
+		device, err := Open(deviceCfg, trace)
+		if err != nil {
+			d.Close()
+			return nil, err
+		}
+		d.devices = append(d.devices, device)
+	}
+	return d, nil
+}
+
+func (d *Devices) Close() {
+	for _, device := range d.devices {
+		device.Close()
+	}
+	midi.CloseDriver()
+	log.Info().Msg("midi closed")
+}
+
+// Listen sends the messages of all devices to out.
+func (d *Devices) Listen(out chan MidiMessage) (func(), error) {
+	stops := make([]func(), 0, len(d.devices))
+	stopAll := func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+
+	for _, device := range d.devices {
+		stop, err := device.Listen(out)
+		if err != nil {
+			stopAll()
+			return nil, err
+		}
+		stops = append(stops, stop)
+	}
+
+	return stopAll, nil
+}
+
+// Device returns the device with the given name, or nil.
+func (d *Devices) Device(name string) *MidiClient {
+	for _, device := range d.devices {
+		if device.cfg.Name == name {
+			return device
+		}
+	}
+	return nil
+}
+
+// ControlHook returns a mapstructure decode hook for controls in action
+// configs.
+func (d *Devices) ControlHook() mapstructure.DecodeHookFuncType {
+	return d.cfg.ControlHook()
+}
+
+// SetLed turns an LED on or off, and shows it in the monitor with its
+// cause.
+func (d *Devices) SetLed(c config.Control, state bool, cause monitor.Cause) {
+	device := d.Device(c.Device)
+	if device == nil {
+		log.Warn().Msgf("led %s: unknown device", c)
+		return
+	}
+	device.SetLed(c.Key, state, cause)
+}
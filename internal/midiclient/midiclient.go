@@ -2,8 +2,11 @@ package midiclient
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/monitor"
+	"github.com/c0deaddict/midimix/internal/profile"
 	"github.com/rs/zerolog/log"
 	"gitlab.com/gomidi/midi/v2"
 	"gitlab.com/gomidi/midi/v2/drivers"
@@ -11,78 +14,198 @@ import (
 )
 
 type MidiClient struct {
-	in  drivers.In
-	out drivers.Out
-	cfg *config.MidiConfig
+	in      drivers.In
+	out     drivers.Out
+	cfg     *config.MidiConfig
+	channel uint8
+	// maxValue is the value of a control at its maximum.
+	maxValue float32
+	trace    *monitor.Tracer
 }
 
+// MidiMessage is one of the Midi* message types. Every message carries the
+// name of the device it came from.
 type MidiMessage interface{}
 
 type MidiNoteOn struct {
+	Device   string
 	Key      uint8
 	Velocity float32
 }
 
 type MidiNoteOff struct {
-	Key uint8
+	Device string
+	Key    uint8
 }
 
 type MidiControlChange struct {
-	Key   uint8
-	Value float32
+	Device string
+	Key    uint8
+	Value  float32
 }
 
-func Open(cfg config.MidiConfig) (*MidiClient, error) {
+// MidiPitchBend is a 14-bit pitch bend, scaled to 0..1 with the center at
+// 0.5.
+type MidiPitchBend struct {
+	Device  string
+	Channel uint8
+	Value   float32
+}
+
+type MidiPolyAfterTouch struct {
+	Device   string
+	Key      uint8
+	Pressure float32
+}
+
+// MidiChannelPressure is the channel (mono) aftertouch.
+type MidiChannelPressure struct {
+	Device   string
+	Pressure float32
+}
+
+type MidiProgramChange struct {
+	Device  string
+	Program uint8
+}
+
+// MidiSysEx holds the data of a SysEx message, without the start and end
+// bytes.
+type MidiSysEx struct {
+	Device string
+	Data   []byte
+}
+
+// MidiGesture is a gesture on a button, see the gesture package.
+type MidiGesture struct {
+	Device  string
+	Key     uint8
+	Gesture config.Gesture
+}
+
+// Pressed returns true if msg presses the button of control: a note on for
+// a plain control, or the gesture a control is bound to.
+func Pressed(control config.Control, msg MidiMessage) bool {
+	switch msg := msg.(type) {
+	case MidiNoteOn:
+		return control.Is(msg.Device, msg.Key)
+	case MidiGesture:
+		return control.IsGesture(msg.Device, msg.Key, msg.Gesture)
+	default:
+		return false
+	}
+}
+
+const maxPitchBend = 16383
+
+func Open(cfg config.MidiConfig, trace *monitor.Tracer) (*MidiClient, error) {
 	in, err := midi.FindInPort(cfg.Input)
 	if err != nil {
 		return nil, fmt.Errorf("input midi device %s not found: %v", cfg.Input, err)
 	}
-	log.Info().Msgf("found midi input device: %s", in.String())
+	log.Info().Msgf("found midi input device for %s: %s", cfg.Name, in.String())
 
 	out, err := midi.FindOutPort(cfg.Output)
 	if err != nil {
 		return nil, fmt.Errorf("output midi device %s not found: %v", cfg.Output, err)
 	}
-	log.Info().Msgf("found midi output device: %s", out.String())
+	log.Info().Msgf("found midi output device for %s: %s", cfg.Name, out.String())
 
 	if err := out.Open(); err != nil {
 		return nil, fmt.Errorf("opening midi out: %v", err)
 	}
 
-	return &MidiClient{in, out, &cfg}, nil
+	return &MidiClient{in, out, &cfg, cfg.ResolvedChannel(), float32(*cfg.MaxInputValue), trace}, nil
 }
 
 func (m *MidiClient) Close() {
-	midi.CloseDriver()
-	log.Info().Msg("midi closed")
+	m.in.Close()
+	m.out.Close()
+	log.Info().Msgf("midi device %s closed", m.cfg.Name)
 }
 
 func (m *MidiClient) Listen(out chan MidiMessage) (func(), error) {
-	return midi.ListenTo(m.in, func(msg midi.Message, timestampms int32) {
-		var ch, key, vel, con, val uint8
+	stop, err := midi.ListenTo(m.in, func(msg midi.Message, timestampms int32) {
+		var ch, key, vel, con, val, pressure, program uint8
+		var bend uint16
+		var data []byte
 		switch {
 		case msg.GetNoteOn(&ch, &key, &vel):
-			if ch == m.cfg.Channel {
+			if ch == m.channel {
 				out <- MidiNoteOn{
+					m.cfg.Name,
 					key,
-					float32(vel) / float32(m.cfg.MaxInputValue),
+					float32(vel) / m.maxValue,
 				}
 			}
 
 		case msg.GetNoteOff(&ch, &key, &vel):
-			if ch == m.cfg.Channel {
-				out <- MidiNoteOff{key}
+			if ch == m.channel {
+				out <- MidiNoteOff{m.cfg.Name, key}
 			}
 
 		case msg.GetControlChange(&ch, &con, &val):
-			if ch == m.cfg.Channel {
+			if ch != m.channel {
+				break
+			}
+			// Buttons that send a CC are reported as notes.
+			if m.cfg.Profile != nil && m.cfg.Profile.IsButton(con) {
+				if val != 0 {
+					out <- MidiNoteOn{m.cfg.Name, con, float32(val) / m.maxValue}
+				} else {
+					out <- MidiNoteOff{m.cfg.Name, con}
+				}
+			} else {
 				out <- MidiControlChange{
+					m.cfg.Name,
 					con,
-					float32(val) / float32(m.cfg.MaxInputValue),
+					float32(val) / m.maxValue,
+				}
+			}
+
+		case msg.GetPitchBend(&ch, nil, &bend):
+			// Motor faders send pitch bend on a channel per strip, so these
+			// are not filtered on channel.
+			value := float32(bend) / maxPitchBend
+			if m.cfg.Profile != nil {
+				if control, ok := m.cfg.Profile.PitchBend(ch); ok {
+					out <- MidiControlChange{m.cfg.Name, control.Number, value}
+					break
 				}
 			}
+			out <- MidiPitchBend{m.cfg.Name, ch, value}
+
+		case msg.GetPolyAfterTouch(&ch, &key, &pressure):
+			if ch == m.channel {
+				out <- MidiPolyAfterTouch{m.cfg.Name, key, float32(pressure) / m.maxValue}
+			}
+
+		case msg.GetAfterTouch(&ch, &pressure):
+			if ch == m.channel {
+				out <- MidiChannelPressure{m.cfg.Name, float32(pressure) / m.maxValue}
+			}
+
+		case msg.GetProgramChange(&ch, &program):
+			if ch == m.channel {
+				out <- MidiProgramChange{m.cfg.Name, program}
+			}
+
+		case msg.GetSysEx(&data):
+			sysex := MidiSysEx{m.cfg.Name, append([]byte(nil), data...)}
+			if identity, ok := sysex.Identity(); ok {
+				log.Info().Msgf("midi device %s identity: %v", m.cfg.Name, identity)
+			}
+			out <- sysex
 		}
-	})
+	}, midi.UseSysEx())
+	if err != nil {
+		return nil, err
+	}
+
+	// Ask the device to identify itself, the reply is logged above.
+	m.send(identityRequest)
+
+	return stop, nil
 }
 
 func (m *MidiClient) send(msg midi.Message) error {
@@ -93,18 +216,76 @@ func (m *MidiClient) send(msg midi.Message) error {
 	return err
 }
 
+// led sends the LED state of a button. Without a profile all LEDs are driven
+// with notes.
+func (m *MidiClient) led(key uint8, state bool) {
+	value := uint8(127)
+	ledType := profile.Note
+	if m.cfg.Profile != nil {
+		value = m.cfg.Profile.LedOnValue
+		if control, ok := m.cfg.Profile.Led(key); ok {
+			ledType = control.Type
+		}
+	}
+	if !state {
+		value = 0
+	}
+
+	if ledType == profile.CC {
+		m.send(midi.ControlChange(m.channel, key, value))
+	} else {
+		m.send(midi.NoteOn(m.channel, key, value))
+	}
+}
+
 func (m *MidiClient) LedOn(key uint8) {
-	m.send(midi.NoteOn(m.cfg.Channel, key, 127))
+	m.SetLed(key, true, monitor.Cause{})
 }
 
 func (m *MidiClient) LedOff(key uint8) {
-	m.send(midi.NoteOn(m.cfg.Channel, key, 0))
+	m.SetLed(key, false, monitor.Cause{})
 }
 
-func (m *MidiClient) SetLed(key uint8, state bool) {
+// SetLed turns an LED on or off, and shows it in the monitor with its
+// cause.
+func (m *MidiClient) SetLed(key uint8, state bool, cause monitor.Cause) {
 	if state {
-		m.LedOn(key)
+		m.trace.TraceCause(cause, monitor.KindLed, "%s:%d on", m.cfg.Name, key)
 	} else {
-		m.LedOff(key)
+		m.trace.TraceCause(cause, monitor.KindLed, "%s:%d off", m.cfg.Name, key)
 	}
+	m.led(key, state)
+}
+
+type Port struct {
+	Direction string `json:"direction"`
+	Number    int    `json:"number"`
+	Name      string `json:"name"`
+	Device    string `json:"device,omitempty"`
+}
+
+// Ports lists the available MIDI in and out ports, with the name of the
+// configured device that Open would pick them for.
+func Ports(devices []config.MidiConfig) []Port {
+	ports := make([]Port, 0)
+
+	for _, in := range midi.GetInPorts() {
+		ports = append(ports, Port{"in", in.Number(), in.String(), ""})
+	}
+	for _, out := range midi.GetOutPorts() {
+		ports = append(ports, Port{"out", out.Number(), out.String(), ""})
+	}
+
+	for _, device := range devices {
+		for _, dir := range []struct{ direction, name string }{{"in", device.Input}, {"out", device.Output}} {
+			for i, port := range ports {
+				if port.Direction == dir.direction && dir.name != "" && strings.Contains(port.Name, dir.name) {
+					ports[i].Device = device.Name
+					break
+				}
+			}
+		}
+	}
+
+	return ports
 }
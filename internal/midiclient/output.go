@@ -0,0 +1,101 @@
+package midiclient
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+
+	"github.com/c0deaddict/midimix/internal/monitor"
+)
+
+type virtualOutDriver interface {
+	OpenVirtualOut(name string) (drivers.Out, error)
+}
+
+// Output is a MIDI output port that any message can be sent to, e.g. a synth
+// or a virtual port that a DAW listens on. Values are scaled from 0..1.
+type Output struct {
+	out   drivers.Out
+	name  string
+	trace *monitor.Tracer
+}
+
+// OpenOutput opens the first output port that contains name. With virtual a
+// new virtual port with that name is created instead.
+func OpenOutput(name string, virtual bool, trace *monitor.Tracer) (*Output, error) {
+	var out drivers.Out
+	var err error
+
+	if virtual {
+		drv, ok := drivers.Get().(virtualOutDriver)
+		if !ok {
+			return nil, fmt.Errorf("midi driver does not support virtual ports")
+		}
+		out, err = drv.OpenVirtualOut(name)
+		if err != nil {
+			return nil, fmt.Errorf("opening virtual midi out %s: %v", name, err)
+		}
+		log.Info().Msgf("created virtual midi output: %s", name)
+	} else {
+		out, err = midi.FindOutPort(name)
+		if err != nil {
+			return nil, fmt.Errorf("output midi device %s not found: %v", name, err)
+		}
+		if err := out.Open(); err != nil {
+			return nil, fmt.Errorf("opening midi out: %v", err)
+		}
+		log.Info().Msgf("found midi output device: %s", out.String())
+	}
+
+	return &Output{out, name, trace}, nil
+}
+
+func (o *Output) Close() {
+	o.out.Close()
+}
+
+// send sends msg, and shows it in the monitor with its cause.
+func (o *Output) send(cause monitor.Cause, msg midi.Message) error {
+	o.trace.TraceCause(cause, monitor.KindMidiOut, "%s: %v", o.name, msg)
+	err := o.out.Send(msg)
+	if err != nil {
+		log.Error().Err(err).Msgf("send midi message to %s", o.name)
+	}
+	return err
+}
+
+func scale7(value float32) uint8 {
+	return uint8(clamp(value)*127 + 0.5)
+}
+
+func clamp(value float32) float32 {
+	if value < 0 {
+		return 0
+	} else if value > 1 {
+		return 1
+	}
+	return value
+}
+
+func (o *Output) ControlChange(cause monitor.Cause, channel, controller uint8, value float32) error {
+	return o.send(cause, midi.ControlChange(channel, controller, scale7(value)))
+}
+
+func (o *Output) NoteOn(cause monitor.Cause, channel, key uint8, velocity float32) error {
+	return o.send(cause, midi.NoteOn(channel, key, scale7(velocity)))
+}
+
+func (o *Output) NoteOff(cause monitor.Cause, channel, key uint8) error {
+	return o.send(cause, midi.NoteOff(channel, key))
+}
+
+// PitchBend sends a 14-bit pitch bend, with 0.5 as center.
+func (o *Output) PitchBend(cause monitor.Cause, channel uint8, value float32) error {
+	return o.send(cause, midi.Pitchbend(channel, int16(clamp(value)*maxPitchBend+0.5)-8192))
+}
+
+func (o *Output) ProgramChange(cause monitor.Cause, channel, program uint8) error {
+	return o.send(cause, midi.ProgramChange(channel, program))
+}
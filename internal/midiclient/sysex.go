@@ -0,0 +1,48 @@
+package midiclient
+
+import (
+	"fmt"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// Universal Non-Realtime Identity Request, to all devices.
+var identityRequest = midi.SysEx([]byte{0x7e, 0x7f, 0x06, 0x01})
+
+type Identity struct {
+	Manufacturer []byte
+	Family       uint16
+	Model        uint16
+	Version      [4]byte
+}
+
+func (i Identity) String() string {
+	return fmt.Sprintf("manufacturer=%x family=%04x model=%04x version=%d.%d.%d.%d",
+		i.Manufacturer, i.Family, i.Model, i.Version[0], i.Version[1], i.Version[2], i.Version[3])
+}
+
+// Identity parses a Universal Non-Realtime Identity Reply.
+func (s MidiSysEx) Identity() (Identity, bool) {
+	d := s.Data
+	if len(d) < 4 || d[0] != 0x7e || d[2] != 0x06 || d[3] != 0x02 {
+		return Identity{}, false
+	}
+	d = d[4:]
+
+	// Manufacturer IDs are one byte, or three bytes starting with 0.
+	id := Identity{}
+	n := 1
+	if len(d) > 0 && d[0] == 0 {
+		n = 3
+	}
+	if len(d) < n+8 {
+		return Identity{}, false
+	}
+
+	id.Manufacturer = d[:n]
+	d = d[n:]
+	id.Family = uint16(d[0]) | uint16(d[1])<<7
+	id.Model = uint16(d[2]) | uint16(d[3])<<7
+	copy(id.Version[:], d[4:8])
+	return id, true
+}
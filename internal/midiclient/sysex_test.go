@@ -0,0 +1,60 @@
+package midiclient
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestIdentity(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want Identity
+		ok   bool
+	}{
+		{
+			name: "one byte manufacturer",
+			data: []byte{0x7e, 0x00, 0x06, 0x02, 0x47, 0x31, 0x00, 0x19, 0x00, 0x01, 0x02, 0x03, 0x04},
+			want: Identity{Manufacturer: []byte{0x47}, Family: 0x31, Model: 0x19, Version: [4]byte{1, 2, 3, 4}},
+			ok:   true,
+		},
+		{
+			name: "three byte manufacturer",
+			data: []byte{0x7e, 0x7f, 0x06, 0x02, 0x00, 0x20, 0x29, 0x01, 0x01, 0x02, 0x00, 0x00, 0x00, 0x05, 0x07},
+			want: Identity{Manufacturer: []byte{0x00, 0x20, 0x29}, Family: 0x81, Model: 0x02, Version: [4]byte{0, 0, 5, 7}},
+			ok:   true,
+		},
+		{
+			name: "identity request",
+			data: []byte{0x7e, 0x7f, 0x06, 0x01},
+		},
+		{
+			name: "other message",
+			data: []byte{0x7e, 0x00, 0x09, 0x02, 0x47, 0x31, 0x00, 0x19, 0x00, 0x01, 0x02, 0x03, 0x04},
+		},
+		{
+			name: "truncated",
+			data: []byte{0x7e, 0x00, 0x06, 0x02, 0x00, 0x20, 0x29, 0x01, 0x01, 0x02, 0x00, 0x00, 0x00},
+		},
+		{
+			name: "empty",
+			data: []byte{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := MidiSysEx{Device: "midimix", Data: test.data}.Identity()
+			if ok != test.ok {
+				t.Fatalf("got ok %v, want %v", ok, test.ok)
+			}
+			if !ok {
+				return
+			}
+			if !bytes.Equal(got.Manufacturer, test.want.Manufacturer) ||
+				got.Family != test.want.Family || got.Model != test.want.Model || got.Version != test.want.Version {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
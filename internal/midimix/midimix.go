@@ -1,18 +1,28 @@
 package midimix
 
 import (
+	"encoding/json"
 	"fmt"
+	"time"
 
+	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog/log"
 
 	"github.com/c0deaddict/midimix/internal/action"
 	"github.com/c0deaddict/midimix/internal/action/ledanimation"
 	"github.com/c0deaddict/midimix/internal/action/ledcolor"
+	"github.com/c0deaddict/midimix/internal/action/ledmaster"
 	"github.com/c0deaddict/midimix/internal/action/ledmode"
 	"github.com/c0deaddict/midimix/internal/action/ledsetting"
+	"github.com/c0deaddict/midimix/internal/action/midiforward"
+	"github.com/c0deaddict/midimix/internal/action/sleeptimer"
 	"github.com/c0deaddict/midimix/internal/action/testled"
 	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/gesture"
+	"github.com/c0deaddict/midimix/internal/learn"
+	"github.com/c0deaddict/midimix/internal/leds"
 	"github.com/c0deaddict/midimix/internal/midiclient"
+	"github.com/c0deaddict/midimix/internal/monitor"
 	"github.com/c0deaddict/midimix/internal/natsclient"
 	"github.com/c0deaddict/midimix/internal/paclient"
 )
@@ -22,18 +32,41 @@ var actions = map[string]action.NewAction{
 	"LedMode":      ledmode.New,
 	"LedAnimation": ledanimation.New,
 	"LedSetting":   ledsetting.New,
+	"LedMaster":    ledmaster.New,
 	"TestLed":      testled.New,
+	"MidiForward":  midiforward.New,
+	"SleepTimer":   sleeptimer.New,
 }
 
+const learnTimeout = 30 * time.Second
+
 type Midimix struct {
 	action.Clients
+	cfg        *config.Config
 	actions    []action.Action
 	ch         chan midiclient.MidiMessage
 	stopListen func()
+	learner    *learn.Learner
+	gestures   *gesture.Detector
+	subs       []*nats.Subscription
+}
+
+type learnRequest struct {
+	Path    string `json:"path"`
+	Timeout string `json:"timeout,omitempty"`
+}
+
+type learnReply struct {
+	Path    string `json:"path"`
+	Control string `json:"control,omitempty"`
+	Error   string `json:"error,omitempty"`
 }
 
 func Open(cfg *config.Config) (*Midimix, error) {
-	m := &Midimix{}
+	m := &Midimix{
+		cfg:      cfg,
+		gestures: gesture.New(cfg.Gestures),
+	}
 	var err error
 
 	m.Nats, err = natsclient.Connect("midimix", cfg.Nats)
@@ -41,28 +74,44 @@ func Open(cfg *config.Config) (*Midimix, error) {
 		return nil, fmt.Errorf("nats: %v", err)
 	}
 
-	m.Midi, err = midiclient.Open(cfg.Midi)
+	m.Trace = monitor.New(m.Nats)
+
+	m.Midi, err = midiclient.OpenAll(cfg, m.Trace)
 	if err != nil {
 		m.Nats.Close()
 		return nil, fmt.Errorf("midi: %v", err)
 	}
 
+	m.Leds = leds.New(m.Midi, m.Trace)
+	m.learner = learn.New(cfg, m.Leds)
+
 	m.ch = make(chan midiclient.MidiMessage)
 	m.stopListen, err = m.Midi.Listen(m.ch)
 	if err != nil {
+		m.Leds.Close()
 		m.Midi.Close()
 		m.Nats.Close()
 		return nil, fmt.Errorf("midi listen failed: %v", err)
 	}
 
-	m.Pulse, err = paclient.Open(cfg.PulseAudio, m.Midi)
+	m.Pulse, err = paclient.Open(cfg.PulseAudio, cfg.Gestures, m.Leds, m.Nats, m.Trace)
 	if err != nil {
+		m.Leds.Close()
 		m.Midi.Close()
 		m.Nats.Close()
 		return nil, fmt.Errorf("pulseaudio: %v", err)
 	}
 
-	m.actions = make([]action.Action, 0, len(cfg.Actions))
+	// Groups handle their link buttons like actions.
+	m.Master = action.NewMaster()
+	m.Groups = make(map[string]*action.Group)
+	m.actions = make([]action.Action, 0, len(cfg.Groups)+len(cfg.Actions))
+	for name, hosts := range cfg.Groups {
+		group := action.NewGroup(name, hosts, m.Leds)
+		m.Groups[name] = group
+		m.actions = append(m.actions, group)
+	}
+
 	for _, actionCfg := range cfg.Actions {
 		newAction, ok := actions[actionCfg.Type]
 		if !ok {
@@ -80,36 +129,139 @@ func Open(cfg *config.Config) (*Midimix, error) {
 		m.actions = append(m.actions, action)
 	}
 
+	m.subscribe("midimix.learn", m.onLearnRequest)
+	m.subscribe("midimix.leds", m.onLedsRequest)
+
 	return m, nil
 }
 
+func (m *Midimix) subscribe(subject string, handler nats.MsgHandler) {
+	sub, err := m.Nats.Subscribe(subject, handler)
+	if err != nil {
+		log.Error().Err(err).Msgf("subscribe to %s failed", subject)
+		return
+	}
+	m.subs = append(m.subs, sub)
+}
+
 func (m *Midimix) Run() {
 	go func() {
-		for msg := range m.ch {
-			log.Info().Msgf("%v", msg)
-			m.Pulse.OnMidiMessage(msg)
-			for _, action := range m.actions {
-				action.OnMidiMessage(msg)
+		for {
+			select {
+			case msg, ok := <-m.ch:
+				if !ok {
+					return
+				}
+				m.handle(msg)
+			case msg := <-m.gestures.Events():
+				m.handle(msg)
 			}
-			// TODO: emit all on nats
 		}
 	}()
 
 	m.Pulse.Listen()
 }
 
+// handle dispatches a MIDI message, and the gesture it completes.
+func (m *Midimix) handle(msg midiclient.MidiMessage) {
+	log.Info().Msgf("%v", msg)
+	if m.learner.Offer(msg) {
+		return
+	}
+
+	m.dispatch(msg)
+	if gesture, ok := m.gestures.Offer(msg); ok {
+		log.Info().Msgf("%v", gesture)
+		m.dispatch(gesture)
+	}
+}
+
+func (m *Midimix) dispatch(msg midiclient.MidiMessage) {
+	cause := m.Trace.Begin(msg)
+	m.Pulse.OnMidiMessage(msg, cause)
+	for _, action := range m.actions {
+		action.OnMidiMessage(msg, cause.By(action.String()))
+	}
+}
+
+// onLearnRequest handles learn requests over NATS. The request is either a
+// config path or a JSON object with a path and an optional timeout.
+func (m *Midimix) onLearnRequest(msg *nats.Msg) {
+	req := learnRequest{}
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		req.Path = string(msg.Data)
+	}
+
+	reply := learnReply{Path: req.Path}
+	timeout := learnTimeout
+	if req.Timeout != "" {
+		if d, err := time.ParseDuration(req.Timeout); err != nil {
+			reply.Error = fmt.Sprintf("invalid timeout: %v", err)
+		} else {
+			timeout = d
+		}
+	}
+
+	if reply.Error == "" {
+		control, err := m.learner.Learn(m.cfg.File, req.Path, timeout)
+		if err != nil {
+			log.Warn().Err(err).Msgf("learn %s failed", req.Path)
+			reply.Error = err.Error()
+		} else {
+			log.Info().Msg("learn: restart midimix to apply the new config")
+			reply.Control = control
+		}
+	}
+
+	data, err := json.Marshal(reply)
+	if err != nil {
+		log.Error().Err(err).Msg("marshal learn reply")
+		return
+	}
+	if err := msg.Respond(data); err != nil {
+		log.Warn().Err(err).Msg("respond to learn request failed")
+	}
+}
+
+// onLedsRequest replies with what every LED should show, and which layer
+// decided it.
+func (m *Midimix) onLedsRequest(msg *nats.Msg) {
+	data, err := json.Marshal(m.Leds.Shadow())
+	if err != nil {
+		log.Error().Err(err).Msg("marshal leds reply")
+		return
+	}
+	if err := msg.Respond(data); err != nil {
+		log.Warn().Err(err).Msg("respond to leds request failed")
+	}
+}
+
 func (m *Midimix) Close() {
+	for _, sub := range m.subs {
+		sub.Unsubscribe()
+	}
+	m.Clients.Unsubscribe()
+	m.gestures.Close()
 	if m.ch != nil {
 		close(m.ch)
 	}
 	if m.stopListen != nil {
 		m.stopListen()
 	}
+	for _, a := range m.actions {
+		if closer, ok := a.(action.Closer); ok {
+			closer.Close()
+		}
+	}
 	if m.Pulse != nil {
 		m.Pulse.Close()
 	}
+	if m.Leds != nil {
+		m.Leds.Close()
+	}
 	if m.Midi != nil {
 		m.Midi.Close()
 	}
+	m.Trace.Close()
 	m.Nats.Close()
 }
@@ -0,0 +1,168 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+)
+
+// Subject the daemon publishes monitor events on.
+const Subject = "midimix.monitor"
+
+// Monitors publish on AttachSubject every AttachInterval. The daemon only
+// publishes events while a monitor is attached, so tracing costs nothing
+// otherwise.
+const (
+	AttachSubject  = "midimix.monitor.attach"
+	AttachInterval = 5 * time.Second
+	// A monitor is detached when it missed a few intervals.
+	attachTimeout = 3 * AttachInterval
+)
+
+type Kind string
+
+const (
+	KindMidi    Kind = "midi"
+	KindMidiOut Kind = "out"
+	KindBinding Kind = "bind"
+	KindPulse   Kind = "pulse"
+	KindNats    Kind = "nats"
+	KindLed     Kind = "led"
+)
+
+// Event is something that happened in the daemon. Events caused by handling
+// a MIDI message carry the sequence number of that message, and the name of
+// the target or action that handled it.
+type Event struct {
+	Seq     uint64    `json:"seq"`
+	Time    time.Time `json:"time"`
+	Kind    Kind      `json:"kind"`
+	Handler string    `json:"handler,omitempty"`
+	Message string    `json:"message"`
+}
+
+// Cause is the MIDI message that caused an event, by its sequence number,
+// and the target or action that handled it. Events with the zero Cause were
+// not caused by a MIDI message, e.g. PulseAudio changes made elsewhere.
+type Cause struct {
+	Seq     uint64
+	Handler string
+}
+
+// By returns the cause, handled by handler.
+func (c Cause) By(handler string) Cause {
+	c.Handler = handler
+	return c
+}
+
+// Tracer publishes events on NATS while a monitor is attached. A nil Tracer
+// discards all events.
+type Tracer struct {
+	nc       *nats.Conn
+	sub      *nats.Subscription
+	mu       sync.Mutex
+	seq      uint64
+	attached time.Time
+}
+
+func New(nc *nats.Conn) *Tracer {
+	t := &Tracer{nc: nc}
+	sub, err := nc.Subscribe(AttachSubject, func(*nats.Msg) {
+		t.mu.Lock()
+		t.attached = time.Now()
+		t.mu.Unlock()
+	})
+	if err != nil {
+		log.Error().Err(err).Msgf("subscribe to %s failed", AttachSubject)
+	}
+	t.sub = sub
+	return t
+}
+
+func (t *Tracer) Close() {
+	if t != nil && t.sub != nil {
+		t.sub.Unsubscribe()
+	}
+}
+
+// Attached returns true while a monitor is attached.
+func (t *Tracer) Attached() bool {
+	if t == nil {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Since(t.attached) < attachTimeout
+}
+
+// Begin starts handling a MIDI message, and returns the cause of the events
+// that handling it causes.
+func (t *Tracer) Begin(msg interface{}) Cause {
+	if !t.Attached() {
+		return Cause{}
+	}
+
+	t.mu.Lock()
+	t.seq++
+	cause := Cause{Seq: t.seq}
+	t.mu.Unlock()
+
+	t.TraceCause(cause, KindMidi, "%T%+v", msg, msg)
+	return cause
+}
+
+// Trace publishes an event that was not caused by a MIDI message.
+func (t *Tracer) Trace(kind Kind, format string, args ...interface{}) {
+	t.TraceCause(Cause{}, kind, format, args...)
+}
+
+// TraceCause publishes an event with its cause.
+func (t *Tracer) TraceCause(cause Cause, kind Kind, format string, args ...interface{}) {
+	if !t.Attached() {
+		return
+	}
+
+	event := Event{
+		Seq:     cause.Seq,
+		Time:    time.Now(),
+		Kind:    kind,
+		Handler: cause.Handler,
+		Message: fmt.Sprintf(format, args...),
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Error().Err(err).Msg("marshal monitor event")
+		return
+	}
+
+	if err := t.nc.Publish(Subject, data); err != nil {
+		log.Warn().Err(err).Msg("publish monitor event failed")
+	}
+}
+
+// Format renders an event as a single line. Events caused by a MIDI message
+// are indented below it.
+func (e Event) Format() string {
+	ts := e.Time.Format("15:04:05.000")
+	if e.Kind == KindMidi {
+		return fmt.Sprintf("%s #%-5d %s", ts, e.Seq, e.Message)
+	}
+
+	// Events that were not caused by a MIDI message, e.g. PulseAudio changes
+	// made elsewhere, are not indented.
+	prefix := "    ->"
+	if e.Seq == 0 {
+		prefix = "      "
+	}
+
+	if e.Handler != "" {
+		return fmt.Sprintf("%s %s %-5s [%s] %s", ts, prefix, e.Kind, e.Handler, e.Message)
+	}
+	return fmt.Sprintf("%s %s %-5s %s", ts, prefix, e.Kind, e.Message)
+}
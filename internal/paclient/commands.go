@@ -0,0 +1,168 @@
+package paclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/monitor"
+)
+
+type command = func(p *PulseAudioClient, target *PulseAudioTarget, arg string) error
+
+// Commands are requested on the subject of a target, see TargetSubject.
+var commands = map[string]command{
+	"volume":  volumeCommand,
+	"mute":    muteCommand,
+	"default": defaultCommand,
+	"move":    moveCommand,
+	"profile": profileCommand,
+	"port":    portCommand,
+}
+
+type commandReply struct {
+	State *State `json:"state,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+func (p *PulseAudioClient) subscribeCommands() {
+	for name, cmd := range commands {
+		name, cmd := name, cmd
+		subject := TargetSubject("*", name)
+		sub, err := p.nats.Subscribe(subject, func(msg *nats.Msg) {
+			p.onCommand(msg, name, cmd)
+		})
+		if err != nil {
+			log.Error().Err(err).Msgf("subscribe to %s failed", subject)
+			continue
+		}
+		p.subs = append(p.subs, sub)
+	}
+}
+
+func (p *PulseAudioClient) onCommand(msg *nats.Msg, name string, cmd command) {
+	id := strings.Split(msg.Subject, ".")[2]
+	arg := strings.TrimSpace(string(msg.Data))
+
+	p.mu.Lock()
+	reply := commandReply{}
+	target := p.findTargetById(id)
+	if target == nil {
+		reply.Error = fmt.Sprintf("unknown target %s", id)
+	} else {
+		p.tracef(monitor.KindNats, "%s %s", msg.Subject, arg)
+		if len(target.ids) == 0 {
+			reply.Error = fmt.Sprintf("%s is not present", target.cfg.Name)
+		} else if err := cmd(p, target, arg); err != nil {
+			reply.Error = err.Error()
+		}
+	}
+	commands := p.takePactl()
+	p.mu.Unlock()
+
+	if err := runPactl(commands); err != nil && reply.Error == "" {
+		reply.Error = err.Error()
+	}
+	if target != nil {
+		p.mu.Lock()
+		state := target.state()
+		p.mu.Unlock()
+		reply.State = &state
+	}
+
+	if reply.Error != "" {
+		log.Warn().Msgf("%s %s: %s", name, id, reply.Error)
+	}
+
+	if msg.Reply == "" {
+		return
+	}
+	data, err := json.Marshal(reply)
+	if err != nil {
+		log.Error().Err(err).Msg("marshal command reply")
+		return
+	}
+	if err := msg.Respond(data); err != nil {
+		log.Warn().Err(err).Msg("respond to command failed")
+	}
+}
+
+// volumeCommand sets the volume to a value between 0 and 1, or changes it
+// when the value starts with a sign.
+func volumeCommand(p *PulseAudioClient, target *PulseAudioTarget, arg string) error {
+	value, err := strconv.ParseFloat(arg, 32)
+	if err != nil {
+		return fmt.Errorf("invalid volume %q", arg)
+	}
+
+	volume := float32(value)
+	if strings.HasPrefix(arg, "+") || strings.HasPrefix(arg, "-") {
+		volume += target.level()
+	}
+	if volume < 0 {
+		volume = 0
+	} else if volume > 1 {
+		volume = 1
+	}
+
+	return p.glideVolume(target, volume)
+}
+
+// muteCommand mutes ("true") or unmutes ("false") the target, or toggles
+// the mute state when no value or "toggle" is given.
+func muteCommand(p *PulseAudioClient, target *PulseAudioTarget, arg string) error {
+	mute := !target.mute
+	if arg != "" && arg != "toggle" {
+		var err error
+		mute, err = strconv.ParseBool(arg)
+		if err != nil {
+			return fmt.Errorf("invalid mute %q", arg)
+		}
+	}
+
+	return p.setMuted(target, mute)
+}
+
+func defaultCommand(p *PulseAudioClient, target *PulseAudioTarget, arg string) error {
+	return p.setDefault(target)
+}
+
+// moveCommand moves the streams of a target to the sink or source with the
+// given target id, or PulseAudio name.
+func moveCommand(p *PulseAudioClient, target *PulseAudioTarget, arg string) error {
+	var destType config.PulseAudioTargetType
+	var command string
+	switch target.cfg.Type {
+	case config.PlaybackStream:
+		destType, command = config.Sink, "move-sink-input"
+	case config.RecordStream:
+		destType, command = config.Source, "move-source-output"
+	default:
+		return fmt.Errorf("%s cannot be moved", target.cfg.Type)
+	}
+
+	dest := arg
+	if other := p.findTargetById(arg); other != nil {
+		if other.cfg.Type != destType {
+			return fmt.Errorf("%s is not a %s", other.cfg.Name, destType)
+		}
+		if len(other.ids) == 0 {
+			return fmt.Errorf("%s is not present", other.cfg.Name)
+		}
+		dest = other.name()
+	}
+	if dest == "" {
+		return fmt.Errorf("no %s given", destType)
+	}
+
+	for _, id := range target.ids {
+		p.tracef(monitor.KindPulse, "move %s %s to %s", target.cfg.Type, id.name, dest)
+		p.queuePactl(command, strconv.Itoa(int(id.index)), dest)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package paclient
+
+import (
+	"math"
+
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/transition"
+)
+
+type ducking struct {
+	cfg    config.DuckingRule
+	active bool
+}
+
+// gain returns the factor a ducked volume is multiplied with. PulseAudio
+// volumes are cubic, so 1 dB is a factor of 10^(1/60) on that scale.
+func (d *ducking) gain() float64 {
+	return math.Pow(10, -d.cfg.Amount/60)
+}
+
+// triggered returns true if one of the triggers of a rule is active. Must be
+// called with the lock held.
+func (p *PulseAudioClient) triggered(d *ducking) bool {
+	for _, trigger := range d.cfg.Triggers {
+		target := p.findTargetById(trigger.Target)
+		if target == nil || len(target.ids) == 0 {
+			continue
+		}
+
+		switch trigger.When {
+		case config.WhenPresent:
+			return true
+		case config.WhenUnmuted:
+			if !target.mute {
+				return true
+			}
+		case config.WhenActive:
+			if target.active {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// updateDucking ducks the targets of rules that became active, and raises
+// the targets of rules that are no longer active. A target in several
+// active rules is ducked by the largest amount. Must be called with the lock
+// held.
+func (p *PulseAudioClient) updateDucking() {
+	goals := make(map[*PulseAudioTarget]float64)
+	ramps := make(map[*PulseAudioTarget]transition.Config)
+	for i := range p.ducking {
+		d := &p.ducking[i]
+		active := p.triggered(d)
+		changed := active != d.active
+		d.active = active
+
+		for _, id := range d.cfg.Targets {
+			target := p.findTargetById(id)
+			if _, ok := goals[target]; !ok {
+				goals[target] = 1
+			}
+			if active {
+				goals[target] = math.Min(goals[target], d.gain())
+			}
+			if changed {
+				ramps[target] = *d.cfg.Ramp
+			}
+		}
+	}
+
+	for target, goal := range goals {
+		// A target that just appeared is not ducked yet.
+		if goal == target.duckGain && (target.duck != nil || goal == target.gain) {
+			continue
+		}
+		target.duckGain = goal
+
+		if len(target.ids) == 0 {
+			p.stopDucking(target)
+			target.gain = goal
+			continue
+		}
+		// Without a ramp, a target that appeared while a rule was active is
+		// ducked right away.
+		p.rampGain(target, ramps[target], goal)
+	}
+}
+
+// rampGain ramps the gain of target to goal. Must be called with the lock
+// held.
+func (p *PulseAudioClient) rampGain(target *PulseAudioTarget, cfg transition.Config, goal float64) {
+	p.stopDucking(target)
+	from := target.gain
+	target.duck = transition.Start(cfg, func(t *transition.Transition, progress float64) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		if target.duck != t {
+			return
+		}
+
+		if progress < 1 {
+			target.gain = transition.Lerp(from, goal, progress)
+			p.applyVolume(target, target.volume)
+			return
+		}
+
+		// The goal is set exactly, so updateDucking sees it was reached.
+		target.gain = goal
+		target.duck = nil
+		p.applyVolume(target, target.volume)
+		p.update(target)
+	})
+}
+
+func (p *PulseAudioClient) stopDucking(target *PulseAudioTarget) {
+	if target.duck != nil {
+		target.duck.Stop()
+		target.duck = nil
+	}
+}
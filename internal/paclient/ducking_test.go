@@ -0,0 +1,102 @@
+package paclient
+
+import (
+	"math"
+	"testing"
+
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/transition"
+)
+
+func TestGain(t *testing.T) {
+	tests := []struct {
+		amount float64
+		want   float64
+	}{
+		{0, 1},
+		{20, math.Pow(10, -1.0/3)},
+		{60, 0.1},
+		{120, 0.01},
+	}
+
+	for _, test := range tests {
+		d := ducking{cfg: config.DuckingRule{Amount: test.amount}}
+		if got := d.gain(); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("gain of %v dB = %v, want %v", test.amount, got, test.want)
+		}
+	}
+}
+
+func TestTriggered(t *testing.T) {
+	present := []targetId{{index: 1, name: "present"}}
+	tests := []struct {
+		name   string
+		target PulseAudioTarget
+		when   config.DuckingWhen
+		want   bool
+	}{
+		{"present", PulseAudioTarget{ids: present}, config.WhenPresent, true},
+		{"absent", PulseAudioTarget{}, config.WhenPresent, false},
+		{"unmuted", PulseAudioTarget{ids: present}, config.WhenUnmuted, true},
+		{"muted", PulseAudioTarget{ids: present, mute: true}, config.WhenUnmuted, false},
+		{"absent unmuted", PulseAudioTarget{}, config.WhenUnmuted, false},
+		{"active", PulseAudioTarget{ids: present, active: true}, config.WhenActive, true},
+		{"idle", PulseAudioTarget{ids: present}, config.WhenActive, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.target.cfg.Id = "call"
+			p := &PulseAudioClient{targets: []PulseAudioTarget{test.target}}
+			d := &ducking{cfg: config.DuckingRule{
+				Triggers: []config.DuckingTrigger{
+					{Target: "unknown", When: config.WhenPresent},
+					{Target: "call", When: test.when},
+				},
+			}}
+			if got := p.triggered(d); got != test.want {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestUpdateDucking(t *testing.T) {
+	// Targets that do not exist take their gain right away, so no volume is
+	// set.
+	call := PulseAudioTarget{ids: []targetId{{index: 1}}}
+	call.cfg.Id = "call"
+	music := PulseAudioTarget{gain: 1, duckGain: 1}
+	music.cfg.Id = "music"
+	p := &PulseAudioClient{targets: []PulseAudioTarget{call, music}}
+
+	ramp := transition.Config{Easing: transition.Linear}
+	rule := func(name string, amount float64) ducking {
+		return ducking{cfg: config.DuckingRule{
+			Name:     name,
+			Triggers: []config.DuckingTrigger{{Target: "call", When: config.WhenUnmuted}},
+			Targets:  []string{"music"},
+			Amount:   amount,
+			Ramp:     &ramp,
+		}}
+	}
+	p.ducking = []ducking{rule("soft", 20), rule("hard", 60)}
+
+	// The largest amount of the active rules wins.
+	p.updateDucking()
+	if got := p.targets[1].gain; math.Abs(got-0.1) > 1e-9 {
+		t.Fatalf("ducked gain = %v, want 0.1", got)
+	}
+
+	// Muting the call raises the music again.
+	p.targets[0].mute = true
+	p.updateDucking()
+	if got := p.targets[1].gain; got != 1 {
+		t.Fatalf("raised gain = %v, want 1", got)
+	}
+	for _, d := range p.ducking {
+		if d.active {
+			t.Fatalf("rule %s is still active", d.cfg.Name)
+		}
+	}
+}
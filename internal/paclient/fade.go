@@ -0,0 +1,148 @@
+package paclient
+
+import (
+	"fmt"
+
+	"github.com/c0deaddict/midimix/internal/transition"
+)
+
+// setMuted mutes or unmutes target from a button or command. A target with
+// a fade is faded out before it is muted, and faded in after it is unmuted.
+// Must be called with the lock held.
+func (p *PulseAudioClient) setMuted(target *PulseAudioTarget, mute bool) error {
+	if target.cfg.Fade == nil || len(target.ids) == 0 {
+		p.stopFade(target)
+		return p.applyMute(target, mute)
+	}
+	if mute == target.mute {
+		return nil
+	}
+	if mute {
+		p.fadeOut(target, *target.cfg.Fade)
+		return nil
+	}
+
+	level := target.level()
+	if target.fade != nil {
+		// Reverse the running fade from where it is.
+		target.fade.Stop()
+		target.fade = nil
+	} else if err := p.applyVolume(target, 0); err != nil {
+		return err
+	}
+
+	err := p.applyMute(target, false)
+	p.startFade(target, *target.cfg.Fade, level, level, nil)
+	return err
+}
+
+// fadeOut fades target out with cfg, and mutes it. Must be called with the
+// lock held.
+func (p *PulseAudioClient) fadeOut(target *PulseAudioTarget, cfg transition.Config) {
+	level := target.level()
+	if target.fade != nil {
+		target.fade.Stop()
+		target.fade = nil
+	}
+
+	// Show the target as muted right away, it is muted in PulseAudio at the
+	// end of the fade.
+	target.mute = true
+	p.update(target)
+	p.startFade(target, cfg, 0, level, func() {
+		p.applyMute(target, true)
+		p.applyVolume(target, level)
+	})
+}
+
+// HasTarget returns true when a target with id is configured.
+func (p *PulseAudioClient) HasTarget(id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.findTargetById(id) != nil
+}
+
+// FadeOut fades the target with id out with cfg, instead of the fade of the
+// target, and mutes it.
+func (p *PulseAudioClient) FadeOut(id string, cfg transition.Config) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	target := p.findTargetById(id)
+	if target == nil {
+		return fmt.Errorf("unknown target %s", id)
+	}
+	if len(target.ids) == 0 {
+		return fmt.Errorf("%s is not present", target.cfg.Name)
+	}
+	if target.mute && target.fade == nil {
+		return nil
+	}
+
+	p.fadeOut(target, cfg)
+	return nil
+}
+
+// glideVolume sets the volume of target from a command, gliding to it when
+// the target has a glide. Must be called with the lock held.
+func (p *PulseAudioClient) glideVolume(target *PulseAudioTarget, volume float32) error {
+	if target.cfg.Glide == nil || len(target.ids) == 0 {
+		p.stopFade(target)
+		return p.applyVolume(target, volume)
+	}
+
+	p.stopFade(target)
+	p.startFade(target, *target.cfg.Glide, volume, volume, nil)
+	return nil
+}
+
+// startFade moves the volume of target from where it is now to volume,
+// then calls done. The level is what the volume will be after the fade, see
+// level. Must be called with the lock held.
+func (p *PulseAudioClient) startFade(target *PulseAudioTarget, cfg transition.Config, volume float32, level float32, done func()) {
+	from := float64(target.volume)
+	target.fadeLevel = level
+	target.fade = transition.Start(cfg, func(t *transition.Transition, progress float64) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		// A newer fade or a fader move took over.
+		if target.fade != t {
+			return
+		}
+
+		p.applyVolume(target, float32(transition.Lerp(from, float64(volume), progress)))
+		if progress == 1 {
+			target.fade = nil
+			if done != nil {
+				done()
+			}
+			p.update(target)
+		}
+	})
+}
+
+// stopFade stops the fade or glide of target, when it has one. A target
+// that was fading out is muted right away, at the volume it had before.
+// Must be called with the lock held.
+func (p *PulseAudioClient) stopFade(target *PulseAudioTarget) {
+	if target.fade == nil {
+		return
+	}
+	target.fade.Stop()
+	target.fade = nil
+
+	if target.mute {
+		p.applyMute(target, true)
+		p.applyVolume(target, target.fadeLevel)
+	}
+}
+
+// level returns the volume of target, or the volume it will have after a
+// running fade or glide.
+func (t *PulseAudioTarget) level() float32 {
+	if t.fade != nil {
+		return t.fadeLevel
+	}
+	return t.volume
+}
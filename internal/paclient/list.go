@@ -0,0 +1,116 @@
+package paclient
+
+import (
+	"github.com/lawl/pulseaudio"
+
+	"github.com/c0deaddict/midimix/internal/config"
+)
+
+// PropList entries that are most useful for writing a config.
+var mainProps = []string{
+	"device.description",
+	"device.api",
+	"device.class",
+	"device.bus",
+	"application.name",
+	"application.process.binary",
+	"media.name",
+	"node.name",
+}
+
+type Object struct {
+	Type      config.PulseAudioTargetType `json:"type"`
+	Index     uint32                      `json:"index"`
+	Name      string                      `json:"name"`
+	MatchName string                      `json:"matchName"`
+	Monitor   bool                        `json:"monitor,omitempty"`
+	Props     map[string]string           `json:"props"`
+	Targets   []string                    `json:"targets"`
+}
+
+// List returns all sinks, sources, sink inputs, source outputs and cards,
+// together with the configured targets that match them.
+func List(cfg config.PulseAudioConfig) ([]Object, error) {
+	client, err := pulseaudio.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	objects := make([]Object, 0)
+
+	sinks, err := client.Sinks()
+	if err != nil {
+		return nil, err
+	}
+	for _, sink := range sinks {
+		objects = append(objects, newObject(cfg, sink, sink.Index, sink.Name, sink.PropList))
+	}
+
+	sources, err := client.Sources()
+	if err != nil {
+		return nil, err
+	}
+	for _, source := range sources {
+		obj := newObject(cfg, source, source.Index, source.Name, source.PropList)
+		if source.MonitorSourceName != "" {
+			// Monitors are never bound to a target, see refresh.
+			obj.Monitor = true
+			obj.Targets = obj.Targets[:0]
+		}
+		objects = append(objects, obj)
+	}
+
+	sinkInputs, err := client.SinkInputs()
+	if err != nil {
+		return nil, err
+	}
+	for _, sinkInput := range sinkInputs {
+		objects = append(objects, newObject(cfg, sinkInput, sinkInput.Index, sinkInput.Name, sinkInput.PropList))
+	}
+
+	sourceOutputs, err := client.SourceOutputs()
+	if err != nil {
+		return nil, err
+	}
+	for _, sourceOutput := range sourceOutputs {
+		objects = append(objects, newObject(cfg, sourceOutput, sourceOutput.Index, sourceOutput.Name, sourceOutput.PropList))
+	}
+
+	cards, err := client.Cards()
+	if err != nil {
+		return nil, err
+	}
+	for _, card := range cards {
+		objects = append(objects, newObject(cfg, card, card.Index, card.Name, card.PropList))
+	}
+
+	return objects, nil
+}
+
+func newObject(cfg config.PulseAudioConfig, object interface{}, index uint32, name string, propList map[string]string) Object {
+	desc, targetType := describe(object)
+
+	props := make(map[string]string)
+	for _, key := range mainProps {
+		if value, ok := propList[key]; ok {
+			props[key] = value
+		}
+	}
+
+	targets := make([]string, 0)
+	for _, target := range cfg.Targets {
+		if target.Type == targetType && target.Name == desc {
+			targets = append(targets, target.Id)
+		}
+	}
+
+	return Object{
+		Type:      targetType,
+		Index:     index,
+		Name:      name,
+		MatchName: desc,
+		Props:     props,
+		Targets:   targets,
+	}
+}
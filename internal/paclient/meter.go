@@ -0,0 +1,186 @@
+package paclient
+
+import (
+	"math"
+	"time"
+
+	"github.com/lawl/pulseaudio"
+	"github.com/rs/zerolog/log"
+
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/leds"
+	"github.com/c0deaddict/midimix/internal/monitor"
+)
+
+const (
+	// How long a target counts as making sound after its last peak above
+	// the threshold.
+	meterHold = 500 * time.Millisecond
+	// How long the meter LED blinks fast after clipping.
+	clipFlash = time.Second
+)
+
+// meter is a peak stream that records the level of a target.
+type meter struct {
+	source meterSource
+	stream *peakStream
+	// loud is the last peak above the threshold. It is only used by the
+	// stream, see meterPeak.
+	loud     time.Time
+	sounding bool
+}
+
+// meterSource is what a meter records: a source, or a playback stream on
+// the monitor of the sink it plays on. The sink is only there to restart
+// the meter when the stream moves.
+type meterSource struct {
+	source uint32
+	stream uint32
+	sink   uint32
+}
+
+// sourceOf returns what records the level of a PulseAudio object, see
+// refresh.
+func sourceOf(object interface{}) meterSource {
+	s := meterSource{source: invalidIndex, stream: invalidIndex, sink: invalidIndex}
+	switch obj := object.(type) {
+	case pulseaudio.Sink:
+		s.source = obj.MonitorSourceIndex
+	case pulseaudio.Source:
+		s.source = obj.Index
+	case pulseaudio.SinkInput:
+		s.stream = obj.Index
+		s.sink = obj.SinkIndex
+	case pulseaudio.SourceOutput:
+		s.source = obj.SourceIndex
+	}
+	return s
+}
+
+// updateMeter starts the meter of a target that is present, or restarts it
+// when the target is recorded elsewhere, and stops the meter of a target
+// that went away. Must be called with the lock held.
+func (p *PulseAudioClient) updateMeter(target *PulseAudioTarget) {
+	metered := p.peaks != nil && target.cfg.Meter != nil && len(target.ids) != 0
+	if metered && target.meter != nil && target.meter.source == target.meterSource {
+		return
+	}
+
+	p.stopMeter(target)
+	if !metered {
+		return
+	}
+
+	// A meter that failed to start is kept, so it is not started again
+	// until the target is recorded elsewhere.
+	m := &meter{source: target.meterSource}
+	target.meter = m
+	p.tracef(monitor.KindPulse, "meter %s %s", target.cfg.Type, target.cfg.Name)
+	// The stream is created without the lock, because the peaks of other
+	// meters take the lock while the server replies.
+	go p.startMeter(target, m)
+}
+
+func (p *PulseAudioClient) startMeter(target *PulseAudioTarget, m *meter) {
+	stream, err := p.peaks.record(m.source.source, m.source.stream,
+		func(peak float64) { p.meterPeak(target, m, peak) },
+		func(err error) { p.meterClosed(target, m, err) })
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		log.Error().Err(err).Msgf("start meter of %s", target.cfg.Name)
+		return
+	}
+	if target.meter != m {
+		stream.Close()
+		return
+	}
+	m.stream = stream
+}
+
+// stopMeter stops the meter of target. Must be called with the lock held.
+func (p *PulseAudioClient) stopMeter(target *PulseAudioTarget) {
+	if target.meter == nil {
+		return
+	}
+	if target.meter.stream != nil {
+		target.meter.stream.Close()
+	}
+	target.meter = nil
+	target.sounding = false
+}
+
+// meterClosed is called when the server ends the stream of a meter, e.g.
+// when its source went away.
+func (p *PulseAudioClient) meterClosed(target *PulseAudioTarget, m *meter, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if target.meter == m {
+		log.Warn().Err(err).Msgf("meter of %s stopped", target.cfg.Name)
+		target.sounding = false
+		p.update(target)
+	}
+}
+
+// meterPeak updates the target of a meter when it starts or stops making
+// sound, or clips.
+func (p *PulseAudioClient) meterPeak(target *PulseAudioTarget, m *meter, peak float64) {
+	cfg := target.cfg.Meter
+	level := 20 * math.Log10(peak)
+
+	now := time.Now()
+	if level > cfg.Threshold {
+		m.loud = now
+	}
+	clip := level >= cfg.Clip
+	was := m.sounding
+	m.sounding = now.Sub(m.loud) < meterHold
+	if m.sounding == was && !clip {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if target.meter == m {
+		target.sounding = m.sounding
+		if clip {
+			if led := target.meterLed(); led != nil {
+				p.leds.Flash(p.cause, *led, leds.FastBlink, clipFlash)
+			}
+		}
+		p.update(target)
+	}
+}
+
+// updateActive marks the sources that are recorded from. The meters keep
+// their source running, so the state of the source can not tell. Must be
+// called with the lock held.
+func (p *PulseAudioClient) updateActive() {
+	outputs, err := p.client.SourceOutputs()
+	if err != nil {
+		log.Error().Err(err).Msg("list source outputs")
+		return
+	}
+
+	meters := uint32(invalidIndex)
+	if p.peaks != nil {
+		meters = p.peaks.index
+	}
+	for i := range p.targets {
+		target := &p.targets[i]
+		if target.cfg.Type != config.Source {
+			continue
+		}
+		active := false
+		for _, output := range outputs {
+			if !output.Corked && output.ClientIndex != meters && target.hasIndex(output.SourceIndex) {
+				active = true
+			}
+		}
+		if active != target.active {
+			target.active = active
+			p.update(target)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package paclient
+
+import (
+	"fmt"
+
+	"github.com/lawl/pulseaudio"
+	"github.com/rs/zerolog/log"
+
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/midiclient"
+	"github.com/c0deaddict/midimix/internal/monitor"
+)
+
+// Options are the profiles of a card and the ports of a sink or source. A
+// cycle button switches to the next option, and every option can have a key
+// that selects it.
+
+// onOptionMessage handles the profile and port buttons of targets.
+func (p *PulseAudioClient) onOptionMessage(msg midiclient.MidiMessage) {
+	for i := range p.targets {
+		target := &p.targets[i]
+
+		if target.cfg.Profile != nil && midiclient.Pressed(*target.cfg.Profile, msg) {
+			p.traceTarget(target)
+			if err := p.cycleProfile(target); err != nil {
+				log.Error().Err(err).Msgf("cycle profile of %s", target.cfg.Name)
+			}
+		}
+		for _, profile := range target.cfg.Profiles {
+			if profile.Key != nil && midiclient.Pressed(*profile.Key, msg) {
+				p.traceTarget(target)
+				if err := p.setProfile(target, profile.Name); err != nil {
+					log.Error().Err(err).Msgf("set profile of %s", target.cfg.Name)
+				}
+			}
+		}
+
+		if target.cfg.Port != nil && midiclient.Pressed(*target.cfg.Port, msg) {
+			p.traceTarget(target)
+			if err := p.cyclePort(target); err != nil {
+				log.Error().Err(err).Msgf("cycle port of %s", target.cfg.Name)
+			}
+		}
+		for _, port := range target.cfg.Ports {
+			if port.Key != nil && midiclient.Pressed(*port.Key, msg) {
+				p.traceTarget(target)
+				if err := p.setPort(target, port.Name); err != nil {
+					log.Error().Err(err).Msgf("set port of %s", target.cfg.Name)
+				}
+			}
+		}
+	}
+}
+
+// optionIndex returns the index of the option with name, or -1.
+func optionIndex(options []config.Option, name string) int {
+	for i, option := range options {
+		if option.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// nextOption returns the option after active that is available.
+func nextOption(options []config.Option, active string, available func(string) bool) (string, error) {
+	start := optionIndex(options, active)
+	for n := 1; n <= len(options); n++ {
+		option := options[(start+n+len(options))%len(options)]
+		if available(option.Name) {
+			return option.Name, nil
+		}
+	}
+	return "", fmt.Errorf("no option available")
+}
+
+// updateOptionLeds lights the key of the active option, and the cycle button
+// when the active option is not the first one.
+func (p *PulseAudioClient) updateOptionLeds(target *PulseAudioTarget, cycle *config.Control, options []config.Option, active string) {
+	index := optionIndex(options, active)
+	if len(target.ids) == 0 {
+		index = -1
+	}
+
+	if cycle != nil {
+		p.leds.SetLed(p.cause, *cycle, index > 0)
+	}
+	for i, option := range options {
+		if option.Key != nil {
+			p.leds.SetLed(p.cause, *option.Key, i == index)
+		}
+	}
+}
+
+// getCard returns the card with index. The PulseAudio library can only list
+// all cards.
+func (p *PulseAudioClient) getCard(index uint32) (*pulseaudio.Card, error) {
+	cards, err := p.client.Cards()
+	if err != nil {
+		return nil, err
+	}
+	for i := range cards {
+		if cards[i].Index == index {
+			return &cards[i], nil
+		}
+	}
+	return nil, fmt.Errorf("card %d not found", index)
+}
+
+// cycleProfile switches a card to the next configured profile.
+func (p *PulseAudioClient) cycleProfile(target *PulseAudioTarget) error {
+	profile, err := nextOption(target.cfg.Profiles, target.profile, func(string) bool { return true })
+	if err != nil {
+		return err
+	}
+	return p.setProfile(target, profile)
+}
+
+func (p *PulseAudioClient) setProfile(target *PulseAudioTarget, profile string) error {
+	if len(target.ids) == 0 {
+		return fmt.Errorf("%s is not present", target.cfg.Name)
+	}
+
+	p.tracef(monitor.KindPulse, "set profile of card %s to %s", target.name(), profile)
+	if err := p.client.SetCardProfile(target.ids[0].index, profile); err != nil {
+		return err
+	}
+
+	target.profile = profile
+	p.update(target)
+	return nil
+}
+
+// cyclePort switches a sink or source to the next configured port that is
+// not unplugged.
+func (p *PulseAudioClient) cyclePort(target *PulseAudioTarget) error {
+	port, err := nextOption(target.cfg.Ports, target.port, func(name string) bool {
+		return !target.unplugged[name]
+	})
+	if err != nil {
+		return fmt.Errorf("no port of %s is plugged in", target.cfg.Name)
+	}
+	return p.setPort(target, port)
+}
+
+func (p *PulseAudioClient) setPort(target *PulseAudioTarget, port string) error {
+	if len(target.ids) == 0 {
+		return fmt.Errorf("%s is not present", target.cfg.Name)
+	}
+
+	command := "set-sink-port"
+	if target.cfg.Type == config.Source {
+		command = "set-source-port"
+	}
+
+	name := target.name()
+	p.tracef(monitor.KindPulse, "set port of %s %s to %s", target.cfg.Type, name, port)
+	p.queuePactl(command, name, port)
+	return nil
+}
+
+// profileCommand switches a card to the given profile, or to the next
+// configured profile when no profile is given.
+func profileCommand(p *PulseAudioClient, target *PulseAudioTarget, arg string) error {
+	if target.cfg.Type != config.Card {
+		return fmt.Errorf("%s has no profiles", target.cfg.Type)
+	}
+	if arg == "" {
+		return p.cycleProfile(target)
+	}
+	return p.setProfile(target, arg)
+}
+
+// portCommand switches a sink or source to the given port, or to the next
+// configured port when no port is given.
+func portCommand(p *PulseAudioClient, target *PulseAudioTarget, arg string) error {
+	if target.cfg.Type != config.Sink && target.cfg.Type != config.Source {
+		return fmt.Errorf("%s has no ports", target.cfg.Type)
+	}
+	if arg == "" {
+		return p.cyclePort(target)
+	}
+	return p.setPort(target, arg)
+}
@@ -1,13 +1,20 @@
 package paclient
 
 import (
+	"fmt"
+	"math"
+	"sync"
 	"time"
 
 	"github.com/lawl/pulseaudio"
+	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog/log"
 
 	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/leds"
 	"github.com/c0deaddict/midimix/internal/midiclient"
+	"github.com/c0deaddict/midimix/internal/monitor"
+	"github.com/c0deaddict/midimix/internal/transition"
 )
 
 type targetId struct {
@@ -22,17 +29,63 @@ type PulseAudioTarget struct {
 	volume    float32
 	channels  int
 	isDefault bool
+	// active is true for sources that are being recorded from, see
+	// updateActive.
+	active bool
+	// profile is the active profile of a card.
+	profile string
+	// port is the active port of a sink or source, and unplugged has the
+	// ports that jack detection reports as unplugged.
+	port      string
+	unplugged map[string]bool
+	// published is the state that was last published on NATS.
+	published *State
+	// pressed is when the mute button was pressed, and muteBefore the mute
+	// state before that.
+	pressed    time.Time
+	muteBefore bool
+	// fade is the running fade or glide of the volume, and fadeLevel the
+	// volume after it, see level.
+	fade      *transition.Transition
+	fadeLevel float32
+	// volume is the volume before ducking. gain is the factor of ducking
+	// that is applied in PulseAudio, duckGain the factor it ramps to with
+	// duck.
+	gain     float64
+	duckGain float64
+	duck     *transition.Transition
+	// meter records the level from meterSource, and sounding is true while
+	// the target makes sound.
+	meter       *meter
+	meterSource meterSource
+	sounding    bool
 }
 
 type PulseAudioClient struct {
-	client  *pulseaudio.Client
-	cfg     config.PulseAudioConfig
+	client *pulseaudio.Client
+	cfg    config.PulseAudioConfig
+	// mu guards targets, which are updated from PulseAudio events, MIDI
+	// messages and NATS requests.
+	mu      sync.Mutex
 	targets []PulseAudioTarget
-	midi    *midiclient.MidiClient
+	leds    *leds.Layer
+	nats    *nats.Conn
+	trace   *monitor.Tracer
 	updates <-chan pulseaudio.SubscriptionEvent
+	subs    []*nats.Subscription
+	ducking []ducking
+	// tapTime is the longest press of a hybrid mute button that counts as a
+	// tap, the long press time of gestures.
+	tapTime time.Duration
+	// cause is the MIDI message that is being handled, see tracef.
+	cause monitor.Cause
+	// pactls are the pactl commands of the handler, see queuePactl.
+	pactls [][]string
+	// peaks records the meters, it is nil when no target has one.
+	peaks *peakClient
 }
 
-func Open(cfg config.PulseAudioConfig, midi *midiclient.MidiClient) (*PulseAudioClient, error) {
+func Open(cfg config.PulseAudioConfig, gestures config.GestureConfig, engine *leds.Engine, nc *nats.Conn, trace *monitor.Tracer) (*PulseAudioClient, error) {
 	client, err := pulseaudio.NewClient()
 	if err != nil {
 		return nil, err
@@ -47,41 +100,68 @@ func Open(cfg config.PulseAudioConfig, midi *midiclient.MidiClient) (*PulseAudio
 		client:  client,
 		cfg:     cfg,
 		targets: make([]PulseAudioTarget, 0, len(cfg.Targets)),
-		midi:    midi,
+		leds:    engine.Layer("pulseaudio", leds.Background),
+		nats:    nc,
+		trace:   trace,
 		updates: updates,
+		tapTime: gestures.LongPress,
 	}
 
 	for _, targetCfg := range cfg.Targets {
 		pa.targets = append(pa.targets, PulseAudioTarget{
-			cfg:    targetCfg,
-			ids:    make([]targetId, 0),
-			mute:   false,
-			volume: 1.0,
+			cfg:      targetCfg,
+			ids:      make([]targetId, 0),
+			mute:     false,
+			volume:   1.0,
+			gain:     1,
+			duckGain: 1,
 		})
 	}
 
+	for _, rule := range cfg.Ducking {
+		pa.ducking = append(pa.ducking, ducking{cfg: rule})
+	}
+
+	for _, target := range cfg.Targets {
+		if target.Meter == nil {
+			continue
+		}
+		if pa.peaks, err = openPeakClient(); err != nil {
+			log.Error().Err(err).Msg("open meters failed")
+		}
+		break
+	}
+
 	// Refresh now and after 10 seconds. Midimix sometimes starts before the
 	// PulseAudio API sees devices.
 	pa.refreshAll()
 	time.AfterFunc(10*time.Second, pa.refreshAll)
 
+	sub, err := nc.Subscribe(StateSubject, pa.onStateRequest)
+	if err != nil {
+		log.Error().Err(err).Msg("subscribe to state requests failed")
+	} else {
+		pa.subs = append(pa.subs, sub)
+	}
+	pa.subscribeCommands()
+
 	return &pa, nil
 }
 
 func (p *PulseAudioClient) Close() {
-	// Clear all leds.
-	for _, target := range p.targets {
-		if target.cfg.Mute != nil {
-			p.midi.LedOff(*target.cfg.Mute)
-		}
-		if target.cfg.Presence != nil {
-			p.midi.LedOff(*target.cfg.Presence)
-		}
-		if target.cfg.Default != nil {
-			p.midi.LedOff(*target.cfg.Default)
-		}
+	for _, sub := range p.subs {
+		sub.Unsubscribe()
+	}
+	p.mu.Lock()
+	for i := range p.targets {
+		p.stopMeter(&p.targets[i])
 	}
+	p.mu.Unlock()
+	p.leds.ReleaseAll(monitor.Cause{})
 
+	if p.peaks != nil {
+		p.peaks.Close()
+	}
 	p.client.Close()
 }
 
@@ -97,31 +177,50 @@ func (p *PulseAudioClient) Listen() {
 			targetType = config.PlaybackStream
 		case pulseaudio.EventSourceOutput:
 			targetType = config.RecordStream
+		case pulseaudio.EventCard:
+			targetType = config.Card
+		case pulseaudio.EventServer:
+			p.mu.Lock()
+			p.refreshDefaults()
+			p.mu.Unlock()
+			continue
 		default:
 			continue
 		}
 
-		// TODO: lock a mutex for concurrent targets access?
+		p.mu.Lock()
 		switch event.Event & pulseaudio.EventTypeMask {
 		case pulseaudio.EventTypeChange:
 			p.refreshByIndex(event.Index, targetType)
 		case pulseaudio.EventTypeRemove:
 			target := p.removeTargetByIndex(event.Index, targetType)
 			if target != nil {
-				p.updateLedsForTarget(target)
+				p.update(target)
 			}
 		case pulseaudio.EventTypeNew:
 			obj := p.getInfo(event.Index, targetType)
 			if target := p.lookup(obj); target != nil {
 				log.Info().Msgf("new target: (%s) %s", target.cfg.Type, target.cfg.Name)
+				// A new stream is not ducked yet, see updateDucking.
+				if len(target.ids) == 0 {
+					p.stopDucking(target)
+					target.gain = 1
+				}
 				target.refresh(obj)
-				p.updateLedsForTarget(target)
+				p.update(target)
 			}
 		}
+		if targetType == config.Source || targetType == config.RecordStream {
+			p.updateActive()
+		}
+		p.mu.Unlock()
 	}
 }
 
 func (p *PulseAudioClient) refreshAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	sinks, err := p.client.Sinks()
 	if err != nil {
 		log.Error().Err(err).Msg("list sinks")
@@ -158,6 +257,22 @@ func (p *PulseAudioClient) refreshAll() {
 		}
 	}
 
+	cards, err := p.client.Cards()
+	if err != nil {
+		log.Error().Err(err).Msg("list cards")
+	} else {
+		for _, card := range cards {
+			p.lookupAndRefresh(card)
+		}
+	}
+
+	p.updateActive()
+	p.refreshDefaults()
+}
+
+// refreshDefaults reads the default sink and source from the server, and
+// updates all targets.
+func (p *PulseAudioClient) refreshDefaults() {
 	server, err := p.client.ServerInfo()
 	if err != nil {
 		log.Error().Err(err).Msg("get server info")
@@ -172,11 +287,18 @@ func (p *PulseAudioClient) refreshAll() {
 	}
 
 	for i := range p.targets {
-		p.updateLedsForTarget(&p.targets[i])
+		p.update(&p.targets[i])
 	}
 }
 
 func (p *PulseAudioClient) lookup(object interface{}) *PulseAudioTarget {
+	desc, targetType := describe(object)
+	return p.findTarget(desc, targetType)
+}
+
+// describe returns the name a configured target is matched on, and the
+// target type of a PulseAudio object.
+func describe(object interface{}) (string, config.PulseAudioTargetType) {
 	var desc string
 	var targetType config.PulseAudioTargetType
 
@@ -205,9 +327,15 @@ func (p *PulseAudioClient) lookup(object interface{}) *PulseAudioTarget {
 		if value, ok := obj.PropList["application.name"]; ok {
 			desc = value
 		}
+	case pulseaudio.Card:
+		targetType = config.Card
+		desc = obj.Name
+		if value, ok := obj.PropList["device.description"]; ok {
+			desc = value
+		}
 	}
 
-	return p.findTarget(desc, targetType)
+	return desc, targetType
 }
 
 func (p *PulseAudioClient) lookupAndRefresh(obj interface{}) {
@@ -248,6 +376,13 @@ func (p *PulseAudioClient) getInfo(index uint32, targetType config.PulseAudioTar
 			return nil
 		}
 		return *sourceOutput
+	case config.Card:
+		card, err := p.getCard(index)
+		if err != nil {
+			log.Error().Err(err).Msg("refresh card")
+			return nil
+		}
+		return *card
 	default:
 		return nil
 	}
@@ -262,25 +397,66 @@ func (p *PulseAudioClient) refreshByIndex(index uint32, targetType config.PulseA
 	obj := p.getInfo(index, targetType)
 	target.refresh(obj)
 
-	p.updateLedsForTarget(target)
+	p.update(target)
 	return target
 }
 
-func (p *PulseAudioClient) updateLedsForTarget(target *PulseAudioTarget) {
+// update shows the state of target on the LEDs, and publishes it. A change
+// of the target might start or end ducking.
+func (p *PulseAudioClient) update(target *PulseAudioTarget) {
+	p.updateMeter(target)
+	p.updateLeds(target)
+	p.publishState(target)
+	p.updateDucking()
+}
+
+func (p *PulseAudioClient) updateLeds(target *PulseAudioTarget) {
 	if target.cfg.Default != nil {
-		p.midi.SetLed(*target.cfg.Default, target.isDefault)
+		p.leds.SetLed(p.cause, *target.cfg.Default, target.isDefault)
 	}
 
 	if target.cfg.Presence != nil {
-		p.midi.SetLed(*target.cfg.Presence, len(target.ids) != 0)
+		pattern := leds.Off
+		if len(target.ids) != 0 {
+			pattern = leds.On
+			if target.duckGain < 1 {
+				pattern = leds.Pulse
+			}
+		}
+		if target.sounding && (target.cfg.Meter == nil || target.cfg.Meter.Led == nil) {
+			pattern = leds.Blink
+		}
+		p.leds.Set(p.cause, *target.cfg.Presence, pattern)
+	}
+
+	if target.cfg.Meter != nil && target.cfg.Meter.Led != nil {
+		p.leds.SetLed(p.cause, *target.cfg.Meter.Led, target.sounding)
 	}
 
 	if target.cfg.Mute != nil {
-		if len(target.ids) == 0 {
-			p.midi.LedOff(*target.cfg.Mute)
-		} else {
-			p.midi.SetLed(*target.cfg.Mute, target.mute)
-		}
+		p.leds.Set(p.cause, *target.cfg.Mute, target.mutePattern())
+	}
+
+	p.updateOptionLeds(target, target.cfg.Profile, target.cfg.Profiles, target.profile)
+	p.updateOptionLeds(target, target.cfg.Port, target.cfg.Ports, target.port)
+}
+
+// mutePattern returns the pattern of the mute LED. It blinks when a muted
+// stream is present, or when a muted source is being recorded from, to show
+// that something is not heard. It blinks fast when a muted target makes
+// sound, e.g. when talking into a muted call.
+func (t *PulseAudioTarget) mutePattern() leds.Pattern {
+	switch {
+	case len(t.ids) == 0 || !t.mute:
+		return leds.Off
+	case t.sounding:
+		return leds.FastBlink
+	case t.cfg.Type == config.PlaybackStream || t.cfg.Type == config.RecordStream:
+		return leds.Blink
+	case t.cfg.Type == config.Source && t.active:
+		return leds.Blink
+	default:
+		return leds.On
 	}
 }
 
@@ -294,6 +470,16 @@ func (p *PulseAudioClient) findTarget(description string, targetType config.Puls
 	return nil
 }
 
+func (p *PulseAudioClient) findTargetById(id string) *PulseAudioTarget {
+	for i, target := range p.targets {
+		if target.cfg.Id == id {
+			return &p.targets[i]
+		}
+	}
+
+	return nil
+}
+
 func (p *PulseAudioClient) findTargetByIndex(index uint32, targetType config.PulseAudioTargetType) *PulseAudioTarget {
 	for i, target := range p.targets {
 		if target.cfg.Type != targetType {
@@ -328,78 +514,182 @@ func (p *PulseAudioClient) removeTargetByIndex(index uint32, targetType config.P
 	return nil
 }
 
-func (p *PulseAudioClient) setDefault(target *PulseAudioTarget) {
+func (p *PulseAudioClient) setDefault(target *PulseAudioTarget) error {
+	if target.cfg.Type != config.Sink && target.cfg.Type != config.Source {
+		return fmt.Errorf("%s cannot be the default", target.cfg.Type)
+	}
+
 	for i, other := range p.targets {
-		if &other == target {
+		if &p.targets[i] == target {
 			continue
 		}
 
-		if other.cfg.Type == target.cfg.Type && p.targets[i].isDefault {
+		if other.cfg.Type == target.cfg.Type && other.isDefault {
 			p.targets[i].isDefault = false
-			if other.cfg.Default != nil {
-				p.midi.LedOff(*other.cfg.Default)
-			}
+			p.update(&p.targets[i])
 		}
 	}
 
 	target.isDefault = true
-	if target.cfg.Default != nil {
-		p.midi.LedOn(*target.cfg.Default)
-	}
+	p.update(target)
 
+	p.tracef(monitor.KindPulse, "set default %s %s", target.cfg.Type, target.name())
 	if target.cfg.Type == config.Sink {
-		err := p.client.SetDefaultSink(target.name())
-		if err != nil {
-			log.Error().Err(err).Msgf("set default sink")
+		return p.client.SetDefaultSink(target.name())
+	} else {
+		return p.client.SetDefaultSource(target.name())
+	}
+}
+
+// applyVolume sets the volume of every stream or device of target. The
+// volume is lowered in PulseAudio while the target is ducked.
+func (p *PulseAudioClient) applyVolume(target *PulseAudioTarget, volume float32) error {
+	var err error
+	target.volume = volume
+	for _, id := range target.ids {
+		if e := p.setVolume(target, id, volume*float32(target.gain)); e != nil {
+			log.Error().Err(e).Msgf("failed to set volume of %s %s", target.cfg.Type, id.name)
+			err = e
 		}
-	} else if target.cfg.Type == config.Source {
-		err := p.client.SetDefaultSource(target.name())
-		if err != nil {
-			log.Error().Err(err).Msgf("set default source")
+	}
+	return err
+}
+
+// applyMute mutes or unmutes every stream or device of target.
+func (p *PulseAudioClient) applyMute(target *PulseAudioTarget, mute bool) error {
+	var err error
+	target.mute = mute
+	for _, id := range target.ids {
+		if e := p.setMute(target, id, mute); e != nil {
+			log.Error().Err(e).Msgf("failed to set mute on %s %s", target.cfg.Type, id.name)
+			err = e
+		}
+	}
+	p.update(target)
+	return err
+}
+
+// mutePressed handles pressing the mute button of target, see MuteMode.
+func (p *PulseAudioClient) mutePressed(target *PulseAudioTarget) {
+	target.pressed = time.Now()
+	target.muteBefore = target.mute
+
+	switch target.cfg.MuteMode {
+	case config.PushToTalk:
+		p.setMuted(target, false)
+	case config.PushToMute:
+		p.setMuted(target, true)
+	case config.MuteHybrid:
+		p.setMuted(target, !target.mute)
+	}
+}
+
+// muteReleased handles releasing the mute button of target. A hybrid button
+// that was held longer than a tap goes back to the state before it was
+// pressed.
+func (p *PulseAudioClient) muteReleased(target *PulseAudioTarget) {
+	switch target.cfg.MuteMode {
+	case config.MuteToggle:
+		p.setMuted(target, !target.mute)
+	case config.PushToTalk:
+		p.setMuted(target, true)
+	case config.PushToMute:
+		p.setMuted(target, false)
+	case config.MuteHybrid:
+		if time.Since(target.pressed) >= p.tapTime {
+			p.setMuted(target, target.muteBefore)
 		}
 	}
 }
 
-func (p *PulseAudioClient) OnMidiMessage(msg midiclient.MidiMessage) {
+// OnMidiMessage handles msg. The monitor events it causes are attributed to
+// cause.
+func (p *PulseAudioClient) OnMidiMessage(msg midiclient.MidiMessage, cause monitor.Cause) {
+	p.mu.Lock()
+	p.cause = cause.By("pulseaudio")
+	p.onMidiMessage(msg)
+	p.cause = monitor.Cause{}
+	commands := p.takePactl()
+	p.mu.Unlock()
+
+	if err := runPactl(commands); err != nil {
+		log.Error().Err(err).Msg("pactl failed")
+	}
+}
+
+// onMidiMessage handles msg. Must be called with the lock held.
+func (p *PulseAudioClient) onMidiMessage(msg midiclient.MidiMessage) {
+	p.onOptionMessage(msg)
+
 	switch msg := msg.(type) {
 	case midiclient.MidiControlChange:
 		for i, target := range p.targets {
-			if target.cfg.Volume != nil && *target.cfg.Volume == msg.Key {
-				volume := msg.Value
-				p.targets[i].volume = volume
-				for _, id := range target.ids {
-					if err := p.setVolume(&target, id, volume); err != nil {
-						log.Error().Err(err).Msgf("failed to set volume of %s %s", target.cfg.Type, id.name)
-					}
-				}
+			if target.cfg.Volume != nil && target.cfg.Volume.Is(msg.Device, msg.Key) {
+				p.traceTarget(&target)
+				p.stopFade(&p.targets[i])
+				p.applyVolume(&p.targets[i], msg.Value)
+			}
+		}
+
+	case midiclient.MidiNoteOn:
+		for i, target := range p.targets {
+			if target.cfg.Mute != nil && target.cfg.Mute.Is(msg.Device, msg.Key) {
+				p.traceTarget(&target)
+				p.mutePressed(&p.targets[i])
 			}
 		}
 
 	case midiclient.MidiNoteOff:
 		for i, target := range p.targets {
-			if target.cfg.Mute != nil && *target.cfg.Mute == msg.Key {
-				mute := !target.mute
-				p.targets[i].mute = mute
-				for _, id := range target.ids {
-					if err := p.setMute(&target, id, mute); err != nil {
-						log.Error().Err(err).Msgf("failed to set mute on %s %s", target.cfg.Type, id.name)
-					} else {
-						target.mute = mute
-						if target.cfg.Mute != nil {
-							p.midi.SetLed(*target.cfg.Mute, mute)
-						}
-					}
+			if target.cfg.Mute != nil && target.cfg.Mute.Is(msg.Device, msg.Key) {
+				p.traceTarget(&target)
+				p.muteReleased(&p.targets[i])
+			}
+
+			if target.cfg.Default != nil && target.cfg.Default.Is(msg.Device, msg.Key) {
+				p.traceTarget(&target)
+				if err := p.setDefault(&p.targets[i]); err != nil {
+					log.Error().Err(err).Msgf("set default %s", target.cfg.Type)
 				}
 			}
+		}
+
+	// A mute or default button that is bound to a gesture toggles mute or
+	// sets the default on that gesture.
+	case midiclient.MidiGesture:
+		for i, target := range p.targets {
+			if target.cfg.Mute != nil && target.cfg.Mute.IsGesture(msg.Device, msg.Key, msg.Gesture) {
+				p.traceTarget(&target)
+				p.setMuted(&p.targets[i], !target.mute)
+			}
 
-			if target.cfg.Default != nil && *target.cfg.Default == msg.Key {
-				p.setDefault(&p.targets[i])
+			if target.cfg.Default != nil && target.cfg.Default.IsGesture(msg.Device, msg.Key, msg.Gesture) {
+				p.traceTarget(&target)
+				if err := p.setDefault(&p.targets[i]); err != nil {
+					log.Error().Err(err).Msgf("set default %s", target.cfg.Type)
+				}
 			}
 		}
 	}
 }
 
+// traceTarget attributes the following monitor events to target. Must be
+// called with the lock held.
+func (p *PulseAudioClient) traceTarget(target *PulseAudioTarget) {
+	p.cause = p.cause.By(fmt.Sprintf("%s %s", target.cfg.Type, target.cfg.Name))
+	if len(target.ids) == 0 {
+		p.tracef(monitor.KindPulse, "not present")
+	}
+}
+
+// tracef publishes a monitor event, caused by the MIDI message that is being
+// handled, if any. Must be called with the lock held.
+func (p *PulseAudioClient) tracef(kind monitor.Kind, format string, args ...interface{}) {
+	p.trace.TraceCause(p.cause, kind, format, args...)
+}
+
 func (p *PulseAudioClient) setVolume(target *PulseAudioTarget, id targetId, volume float32) error {
+	p.tracef(monitor.KindPulse, "set volume of %s %s to %.2f", target.cfg.Type, id.name, volume)
 	switch target.cfg.Type {
 	case config.Sink:
 		return p.client.SetSinkVolume(id.name, volume)
@@ -415,6 +705,7 @@ func (p *PulseAudioClient) setVolume(target *PulseAudioTarget, id targetId, volu
 }
 
 func (p *PulseAudioClient) setMute(target *PulseAudioTarget, id targetId, mute bool) error {
+	p.tracef(monitor.KindPulse, "set mute of %s %s to %v", target.cfg.Type, id.name, mute)
 	switch target.cfg.Type {
 	case config.Sink:
 		return p.client.SetSinkMute(id.name, mute)
@@ -448,6 +739,15 @@ func (t *PulseAudioTarget) matchName(name string) bool {
 	return false
 }
 
+func (t *PulseAudioTarget) hasIndex(index uint32) bool {
+	for _, id := range t.ids {
+		if id.index == index {
+			return true
+		}
+	}
+	return false
+}
+
 func (t *PulseAudioTarget) name() string {
 	if len(t.ids) == 0 {
 		return ""
@@ -456,31 +756,89 @@ func (t *PulseAudioTarget) name() string {
 	}
 }
 
+// PulseAudio port availability, see pa_port_available.
+const portUnplugged = 1
+
+// meterLed returns the LED that shows the level of target, if it has one.
+func (t *PulseAudioTarget) meterLed() *config.Control {
+	if t.cfg.Meter != nil && t.cfg.Meter.Led != nil {
+		return t.cfg.Meter.Led
+	}
+	return t.cfg.Presence
+}
+
 func (t *PulseAudioTarget) refresh(object interface{}) {
+	// A fade sets the mute state and volume itself, and a ducking ramp the
+	// volume, so the steps that PulseAudio reports back are ignored.
+	// Otherwise the ducking is taken out of the volume PulseAudio reports.
+	mute, volume := t.mute, t.volume
+	defer func() {
+		switch {
+		case t.fade != nil:
+			t.mute, t.volume = mute, volume
+		case t.duck != nil:
+			t.volume = volume
+		case t.gain < 1:
+			t.volume = float32(math.Min(1, float64(t.volume)/t.gain))
+		}
+	}()
+
 	switch obj := object.(type) {
 	case pulseaudio.Sink:
 		t.addId(obj.Index, obj.Name)
+		t.meterSource = sourceOf(obj)
 		t.mute = obj.Muted
 		t.channels = len(obj.ChannelMap)
-		// t.volume = obj.Cvolume[0]
+		t.volume = maxVolume(obj.Cvolume)
+		t.port = obj.ActivePortName
+		t.unplugged = make(map[string]bool)
+		for _, port := range obj.Ports {
+			t.unplugged[port.Name] = port.Available == portUnplugged
+		}
 	case pulseaudio.Source:
 		if obj.MonitorSourceName == "" {
 			t.addId(obj.Index, obj.Name)
+			t.meterSource = sourceOf(obj)
 			t.mute = obj.Muted
 			t.channels = len(obj.ChannelMap)
-			// t.volume = obj.Cvolume[0]
+			t.volume = maxVolume(obj.Cvolume)
+			t.port = obj.ActivePortName
+			t.unplugged = make(map[string]bool)
+			for _, port := range obj.Ports {
+				t.unplugged[port.Name] = port.Available == portUnplugged
+			}
 		} else {
 			log.Info().Msgf("ignoring monitor for source %s", t.cfg.Name)
 		}
 	case pulseaudio.SinkInput:
 		t.addId(obj.Index, obj.Name)
+		t.meterSource = sourceOf(obj)
 		t.mute = obj.Muted
 		t.channels = len(obj.ChannelMap)
-		// t.volume = sinkInput.Cvolume[0]
+		t.volume = maxVolume(obj.Cvolume)
 	case pulseaudio.SourceOutput:
 		t.addId(obj.Index, obj.Name)
+		t.meterSource = sourceOf(obj)
 		t.mute = obj.Muted
 		t.channels = len(obj.ChannelMap)
-		// t.volume = sourceOutput.Cvolume[0]
+		t.volume = maxVolume(obj.Cvolume)
+	case pulseaudio.Card:
+		t.addId(obj.Index, obj.Name)
+		t.profile = ""
+		if obj.ActiveProfile != nil {
+			t.profile = obj.ActiveProfile.Name
+		}
+	}
+}
+
+// maxVolume returns the loudest channel of a PulseAudio volume, on the same
+// scale as the volume that is set.
+func maxVolume(cvolume []uint32) float32 {
+	var max uint32
+	for _, v := range cvolume {
+		if v > max {
+			max = v
+		}
 	}
+	return float32(max) / 0xffff
 }
@@ -0,0 +1,50 @@
+package paclient
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// pactl runs a pactl command, for what the PulseAudio library can't do.
+func pactl(args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("pactl", args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("pactl %s: %s", args[0], msg)
+		}
+		return fmt.Errorf("pactl %s: %v", args[0], err)
+	}
+	return nil
+}
+
+// queuePactl queues a pactl command. Handlers run the queued commands after
+// they released the lock, see takePactl, so PulseAudio events and other
+// requests are handled while pactl runs. The state of the targets follows
+// from the PulseAudio events that the commands cause. Must be called with
+// the lock held.
+func (p *PulseAudioClient) queuePactl(args ...string) {
+	p.pactls = append(p.pactls, args)
+}
+
+// takePactl returns the queued pactl commands. Must be called with the lock
+// held.
+func (p *PulseAudioClient) takePactl() [][]string {
+	commands := p.pactls
+	p.pactls = nil
+	return commands
+}
+
+// runPactl runs pactl commands in order, until one fails. Must be called
+// without the lock.
+func runPactl(commands [][]string) error {
+	for _, args := range commands {
+		if err := pactl(args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
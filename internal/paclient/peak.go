@@ -0,0 +1,413 @@
+package paclient
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/lawl/pulseaudio"
+)
+
+// The pulseaudio package has no record streams, so the meters speak just
+// enough of the native protocol to create them, see
+// https://www.freedesktop.org/wiki/Software/PulseAudio/Documentation/Developer/Clients/
+// and pulsecore/protocol-native.c.
+const (
+	protocolVersion = 32
+	// Channel of the packets that are commands, the others carry audio.
+	controlChannel = 0xffffffff
+	// Tag of the commands that the server sends by itself.
+	eventTag     = 0xffffffff
+	invalidIndex = 0xffffffff
+
+	cmdError              = 0
+	cmdReply              = 2
+	cmdCreateRecordStream = 5
+	cmdDeleteRecordStream = 6
+	cmdAuth               = 8
+	cmdSetClientName      = 9
+	cmdRecordStreamKilled = 65
+
+	sampleFloat32LE = 5
+	channelMono     = 0
+
+	// The server sends one peak per fragment, at this rate.
+	peakRate = 25
+
+	meterName = "midimix-meter"
+)
+
+// peakClient records the peak level of sources and playback streams over
+// its own connection. Its streams detect peaks in the server, and do not
+// keep their source from suspending.
+type peakClient struct {
+	conn net.Conn
+	// index is the client index of the connection, see updateActive.
+	index uint32
+
+	// mu guards the fields below, and writes to conn.
+	mu      sync.Mutex
+	tag     uint32
+	pending map[uint32]chan reply
+	streams map[uint32]*peakStream
+	err     error
+}
+
+type reply struct {
+	data *bytes.Buffer
+	err  error
+}
+
+// peakStream calls peak with each peak level, from 0 to 1, and closed when
+// the stream ends by itself.
+type peakStream struct {
+	client  *peakClient
+	channel uint32
+	peak    func(peak float64)
+	closed  func(err error)
+}
+
+func openPeakClient() (*peakClient, error) {
+	path, err := pulseaudio.RuntimePath("native")
+	if err != nil {
+		return nil, err
+	}
+	cookie, err := readCookie()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &peakClient{
+		conn:    conn,
+		pending: make(map[uint32]chan reply),
+		streams: make(map[uint32]*peakStream),
+	}
+	go c.receive()
+
+	if _, err := c.request(cmdAuth, u32(protocolVersion), arbitrary(cookie)); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("auth: %v", err)
+	}
+	data, err := c.request(cmdSetClientName, proplist(map[string]string{
+		"application.name":       meterName,
+		"application.process.id": fmt.Sprint(os.Getpid()),
+	}))
+	if err == nil {
+		c.index, err = getU32(data)
+	}
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("set client name: %v", err)
+	}
+	return c, nil
+}
+
+// readCookie reads the cookie that authenticates with the server, from the
+// same places as libpulse.
+func readCookie() ([]byte, error) {
+	paths := []string{os.Getenv("PULSE_COOKIE")}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		paths = append(paths, filepath.Join(dir, "pulse/cookie"))
+	}
+	home := os.Getenv("HOME")
+	paths = append(paths, filepath.Join(home, ".config/pulse/cookie"), filepath.Join(home, ".pulse-cookie"))
+
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if cookie, err := os.ReadFile(path); err == nil {
+			return cookie, nil
+		}
+	}
+	return nil, fmt.Errorf("no pulse cookie found")
+}
+
+func (c *peakClient) Close() {
+	c.conn.Close()
+}
+
+// record starts a stream on the source with index, or on the monitor of the
+// sink that the playback stream with index stream plays on.
+func (c *peakClient) record(source uint32, stream uint32, peak func(float64), closed func(error)) (*peakStream, error) {
+	data, err := c.request(cmdCreateRecordStream,
+		sampleSpec(sampleFloat32LE, 1, peakRate),
+		channelMap(channelMono),
+		u32(source),
+		stringNull(),
+		u32(math.MaxUint32), // maxlength
+		boolean(false),      // corked
+		u32(4),              // fragsize, a single sample
+		boolean(false),      // no_remap
+		boolean(false),      // no_remix
+		boolean(false),      // fix_format
+		boolean(false),      // fix_rate
+		boolean(false),      // fix_channels
+		boolean(true),       // no_move
+		boolean(false),      // variable_rate
+		boolean(true),       // peak_detect
+		boolean(true),       // adjust_latency
+		proplist(map[string]string{"media.name": "Peak meter"}),
+		u32(stream),    // direct_on_input
+		boolean(false), // early_requests
+		boolean(true),  // dont_inhibit_auto_suspend
+		boolean(false), // fail_on_suspend
+		u8(0),          // no formats, the sample spec is used
+		cvolume(1, 0x10000),
+		boolean(false), // muted
+		boolean(false), // volume_set
+		boolean(false), // muted_set
+		boolean(false), // relative_volume
+		boolean(false), // passthrough
+	)
+	if err != nil {
+		return nil, err
+	}
+	channel, err := getU32(data)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &peakStream{client: c, channel: channel, peak: peak, closed: closed}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.streams[channel] = s
+	return s, nil
+}
+
+// Close deletes the stream. It does not wait for the server, so it can be
+// called from peak.
+func (s *peakStream) Close() {
+	c := s.client
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.streams[s.channel] != s {
+		return
+	}
+	delete(c.streams, s.channel)
+	c.send(cmdDeleteRecordStream, u32(s.channel))
+}
+
+// request sends a command and waits for its reply.
+func (c *peakClient) request(command uint32, args ...[]byte) (*bytes.Buffer, error) {
+	c.mu.Lock()
+	tag, err := c.send(command, args...)
+	var ch chan reply
+	if err == nil {
+		ch = make(chan reply, 1)
+		c.pending[tag] = ch
+	}
+	c.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	r := <-ch
+	return r.data, r.err
+}
+
+// send writes a command without waiting for its reply, and returns its
+// tag. Must be called with the lock held.
+func (c *peakClient) send(command uint32, args ...[]byte) (uint32, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	tag := c.tag
+	c.tag = (c.tag + 1) % eventTag
+
+	var body bytes.Buffer
+	body.Write(u32(command))
+	body.Write(u32(tag))
+	for _, arg := range args {
+		body.Write(arg)
+	}
+
+	header := make([]byte, 20)
+	binary.BigEndian.PutUint32(header[0:], uint32(body.Len()))
+	binary.BigEndian.PutUint32(header[4:], controlChannel)
+	if _, err := c.conn.Write(append(header, body.Bytes()...)); err != nil {
+		return 0, err
+	}
+	return tag, nil
+}
+
+// receive reads packets until the connection breaks, then fails all
+// requests and streams.
+func (c *peakClient) receive() {
+	header := make([]byte, 20)
+	var err error
+	for {
+		if _, err = io.ReadFull(c.conn, header); err != nil {
+			break
+		}
+		size := binary.BigEndian.Uint32(header[0:])
+		channel := binary.BigEndian.Uint32(header[4:])
+		if size > 1<<24 {
+			err = fmt.Errorf("packet of %d bytes is too long", size)
+			break
+		}
+		data := make([]byte, size)
+		if _, err = io.ReadFull(c.conn, data); err != nil {
+			break
+		}
+
+		if channel == controlChannel {
+			c.handleCommand(bytes.NewBuffer(data))
+		} else {
+			c.handleAudio(channel, data)
+		}
+	}
+
+	c.mu.Lock()
+	c.err = fmt.Errorf("connection closed: %v", err)
+	pending, streams := c.pending, c.streams
+	c.pending, c.streams = nil, nil
+	c.mu.Unlock()
+
+	for _, ch := range pending {
+		ch <- reply{err: err}
+	}
+	for _, s := range streams {
+		s.closed(err)
+	}
+}
+
+func (c *peakClient) handleCommand(data *bytes.Buffer) {
+	command, err := getU32(data)
+	if err != nil {
+		return
+	}
+	tag, err := getU32(data)
+	if err != nil {
+		return
+	}
+
+	if tag == eventTag {
+		if command != cmdRecordStreamKilled {
+			return
+		}
+		channel, err := getU32(data)
+		if err != nil {
+			return
+		}
+		c.mu.Lock()
+		s := c.streams[channel]
+		delete(c.streams, channel)
+		c.mu.Unlock()
+		if s != nil {
+			s.closed(fmt.Errorf("killed by the server"))
+		}
+		return
+	}
+
+	c.mu.Lock()
+	ch := c.pending[tag]
+	delete(c.pending, tag)
+	c.mu.Unlock()
+	if ch == nil {
+		return
+	}
+
+	switch command {
+	case cmdReply:
+		ch <- reply{data: data}
+	case cmdError:
+		code, _ := getU32(data)
+		ch <- reply{err: fmt.Errorf("PulseAudio error %d", code)}
+	default:
+		ch <- reply{err: fmt.Errorf("unexpected reply %d", command)}
+	}
+}
+
+// handleAudio calls the stream on channel with the largest peak in data.
+func (c *peakClient) handleAudio(channel uint32, data []byte) {
+	c.mu.Lock()
+	s := c.streams[channel]
+	c.mu.Unlock()
+	if s == nil || len(data) < 4 {
+		return
+	}
+
+	var peak float64
+	for i := 0; i+4 <= len(data); i += 4 {
+		sample := math.Float32frombits(binary.LittleEndian.Uint32(data[i:]))
+		peak = math.Max(peak, math.Abs(float64(sample)))
+	}
+	s.peak(peak)
+}
+
+// Values of a tagstruct, see pulsecore/tagstruct.h.
+
+func u32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32([]byte{'L'}, v)
+}
+
+func u8(v uint8) []byte {
+	return []byte{'B', v}
+}
+
+func boolean(v bool) []byte {
+	if v {
+		return []byte{'1'}
+	}
+	return []byte{'0'}
+}
+
+func stringNull() []byte {
+	return []byte{'N'}
+}
+
+func arbitrary(v []byte) []byte {
+	b := binary.BigEndian.AppendUint32([]byte{'x'}, uint32(len(v)))
+	return append(b, v...)
+}
+
+func sampleSpec(format uint8, channels uint8, rate uint32) []byte {
+	return binary.BigEndian.AppendUint32([]byte{'a', format, channels}, rate)
+}
+
+func channelMap(positions ...uint8) []byte {
+	return append([]byte{'m', uint8(len(positions))}, positions...)
+}
+
+func cvolume(channels uint8, volume uint32) []byte {
+	b := []byte{'v', channels}
+	for i := uint8(0); i < channels; i++ {
+		b = binary.BigEndian.AppendUint32(b, volume)
+	}
+	return b
+}
+
+func proplist(props map[string]string) []byte {
+	b := []byte{'P'}
+	for k, v := range props {
+		b = append(b, 't')
+		b = append(b, k...)
+		b = append(b, 0)
+		value := append([]byte(v), 0)
+		b = append(b, u32(uint32(len(value)))...)
+		b = append(b, arbitrary(value)...)
+	}
+	return append(b, 'N')
+}
+
+func getU32(data *bytes.Buffer) (uint32, error) {
+	b := data.Next(5)
+	if len(b) != 5 || b[0] != 'L' {
+		return 0, fmt.Errorf("protocol error: expected uint32")
+	}
+	return binary.BigEndian.Uint32(b[1:]), nil
+}
@@ -0,0 +1,100 @@
+package paclient
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+
+	"github.com/c0deaddict/midimix/internal/config"
+	"github.com/c0deaddict/midimix/internal/monitor"
+)
+
+// StateSubject is the subject a snapshot of all target states is requested
+// on. Changes of a target are published on its state subject, see
+// TargetSubject.
+const StateSubject = "midimix.pulse.state"
+
+// State is the state of a target as published on NATS.
+type State struct {
+	Id      string                      `json:"id"`
+	Name    string                      `json:"name"`
+	Type    config.PulseAudioTargetType `json:"type"`
+	Present bool                        `json:"present"`
+	Mute    bool                        `json:"mute"`
+	Volume  float32                     `json:"volume"`
+	Default bool                        `json:"default"`
+	// Active is true for sources that are being recorded from.
+	Active bool `json:"active"`
+	// Profile is the active profile of a card.
+	Profile string `json:"profile,omitempty"`
+	// Ducked is true while the volume is lowered by a ducking rule. Volume
+	// is the volume without ducking.
+	Ducked bool `json:"ducked"`
+	// Sounding is true while a metered target makes sound.
+	Sounding bool `json:"sounding"`
+}
+
+// TargetSubject returns the subject for kind ("state", or a command) of the
+// target with id.
+func TargetSubject(id string, kind string) string {
+	return fmt.Sprintf("midimix.pulse.%s.%s", id, kind)
+}
+
+func (t *PulseAudioTarget) state() State {
+	return State{
+		Id:       t.cfg.Id,
+		Name:     t.cfg.Name,
+		Type:     t.cfg.Type,
+		Present:  len(t.ids) != 0,
+		Mute:     t.mute,
+		Volume:   t.volume,
+		Default:  t.isDefault,
+		Active:   t.active,
+		Profile:  t.profile,
+		Ducked:   t.duckGain < 1,
+		Sounding: t.sounding,
+	}
+}
+
+// publishState publishes the state of target when it changed since it was
+// last published. Must be called with the lock held.
+func (p *PulseAudioClient) publishState(target *PulseAudioTarget) {
+	state := target.state()
+	if target.published != nil && *target.published == state {
+		return
+	}
+	target.published = &state
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		log.Error().Err(err).Msg("marshal target state")
+		return
+	}
+
+	subject := TargetSubject(target.cfg.Id, "state")
+	p.tracef(monitor.KindNats, "%s %s", subject, data)
+	if err := p.nats.Publish(subject, data); err != nil {
+		log.Error().Err(err).Msgf("publish state of %s", target.cfg.Name)
+	}
+}
+
+// onStateRequest replies with the states of all targets.
+func (p *PulseAudioClient) onStateRequest(msg *nats.Msg) {
+	p.mu.Lock()
+	states := make([]State, 0, len(p.targets))
+	for i := range p.targets {
+		states = append(states, p.targets[i].state())
+	}
+	p.mu.Unlock()
+
+	data, err := json.Marshal(states)
+	if err != nil {
+		log.Error().Err(err).Msg("marshal target states")
+		return
+	}
+	if err := msg.Respond(data); err != nil {
+		log.Warn().Err(err).Msg("respond to state request failed")
+	}
+}
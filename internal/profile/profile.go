@@ -0,0 +1,152 @@
+package profile
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed profiles/*.yaml
+var builtin embed.FS
+
+type Kind string
+
+const (
+	Button Kind = "button"
+	Knob   Kind = "knob"
+	Fader  Kind = "fader"
+)
+
+type Type string
+
+const (
+	Note      Type = "note"
+	CC        Type = "cc"
+	PitchBend Type = "pitchbend"
+)
+
+// Control is a physical control on a device. Buttons with an LED are lit
+// with the same message type and number they send. Pitch bend faders send on
+// their own channel and are reported as a CC with number.
+type Control struct {
+	Kind    Kind  `yaml:"kind"`
+	Type    Type  `yaml:"type"`
+	Number  uint8 `yaml:"number"`
+	Channel uint8 `yaml:"channel"`
+	Led     bool  `yaml:"led"`
+}
+
+// Profile describes the physical layout of a MIDI controller, so the config
+// can refer to controls by name instead of by key number.
+type Profile struct {
+	Name        string             `yaml:"name"`
+	Description string             `yaml:"description"`
+	Channel     uint8              `yaml:"channel"`
+	LedOnValue  uint8              `yaml:"ledOnValue"`
+	Controls    map[string]Control `yaml:"controls"`
+}
+
+// Builtin returns the names of the built-in profiles.
+func Builtin() []string {
+	entries, err := builtin.ReadDir("profiles")
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		names = append(names, name[:len(name)-len(filepath.Ext(name))])
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Load returns the built-in profile with the given name, or reads the profile
+// from a file. Relative paths are relative to dir.
+func Load(name string, dir string) (*Profile, error) {
+	data, err := builtin.ReadFile("profiles/" + name + ".yaml")
+	if err != nil {
+		path := os.ExpandEnv(name)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %v", name, err)
+		}
+	}
+
+	p := &Profile{}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("profile %s: %v", name, err)
+	}
+
+	if p.LedOnValue == 0 {
+		p.LedOnValue = 127
+	}
+
+	for controlName, control := range p.Controls {
+		if control.Type != Note && control.Type != CC && control.Type != PitchBend {
+			return nil, fmt.Errorf("profile %s: control %s: unknown type %q", name, controlName, control.Type)
+		}
+		if control.Number > 127 {
+			return nil, fmt.Errorf("profile %s: control %s: number out of range", name, controlName)
+		}
+	}
+
+	return p, nil
+}
+
+// Lookup returns the control with the given name.
+func (p *Profile) Lookup(name string) (Control, bool) {
+	control, ok := p.Controls[name]
+	return control, ok
+}
+
+// Find returns the name of the button or the other control that reports
+// with key number. Buttons that send a CC are reported as notes, see IsButton.
+func (p *Profile) Find(button bool, number uint8) (string, bool) {
+	for name, control := range p.Controls {
+		if (control.Kind == Button) == button && control.Number == number {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// IsButton returns true if a control change with number comes from a button.
+// Those are reported as notes, so buttons can be configured the same way on
+// every device.
+func (p *Profile) IsButton(number uint8) bool {
+	for _, control := range p.Controls {
+		if control.Kind == Button && control.Type == CC && control.Number == number {
+			return true
+		}
+	}
+	return false
+}
+
+// PitchBend returns the pitch bend fader on channel.
+func (p *Profile) PitchBend(channel uint8) (Control, bool) {
+	for _, control := range p.Controls {
+		if control.Type == PitchBend && control.Channel == channel {
+			return control, true
+		}
+	}
+	return Control{}, false
+}
+
+// Led returns the LED of the button with key number.
+func (p *Profile) Led(number uint8) (Control, bool) {
+	for _, control := range p.Controls {
+		if control.Kind == Button && control.Led && control.Number == number {
+			return control, true
+		}
+	}
+	return Control{}, false
+}
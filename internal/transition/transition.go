@@ -0,0 +1,115 @@
+package transition
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Easing is the curve a transition follows from start to end.
+type Easing string
+
+const (
+	Linear    Easing = "linear"
+	EaseIn    Easing = "easeIn"
+	EaseOut   Easing = "easeOut"
+	EaseInOut Easing = "easeInOut"
+)
+
+// Transitions step at most at this rate, so a crossfade does not flood
+// PulseAudio or NATS.
+const frameInterval = time.Second / 30
+
+// Config is the duration and easing of a transition.
+type Config struct {
+	Duration time.Duration `yaml:"duration" mapstructure:"duration"`
+	Easing   Easing        `yaml:"easing,omitempty" mapstructure:"easing"`
+}
+
+// Validate checks the config, and defaults the easing to easeInOut.
+func (c *Config) Validate() error {
+	if c.Duration < 0 {
+		return fmt.Errorf("transition duration must not be negative")
+	}
+	switch c.Easing {
+	case "":
+		c.Easing = EaseInOut
+	case Linear, EaseIn, EaseOut, EaseInOut:
+	default:
+		return fmt.Errorf("unknown easing %q", c.Easing)
+	}
+	return nil
+}
+
+// apply maps the linear progress t, between 0 and 1, on the easing curve.
+func (e Easing) apply(t float64) float64 {
+	switch e {
+	case EaseIn:
+		return t * t * t
+	case EaseOut:
+		return 1 - math.Pow(1-t, 3)
+	case EaseInOut:
+		if t < 0.5 {
+			return 4 * t * t * t
+		}
+		return 1 - math.Pow(-2*t+2, 3)/2
+	default:
+		return t
+	}
+}
+
+// Step is called with the eased progress of a transition, between 0 and 1.
+// The transition is passed along, so a step can check that it was not
+// replaced by a newer transition while it waited for a lock.
+type Step = func(t *Transition, progress float64)
+
+// Transition calls a step function on every frame, until it completes or is
+// stopped.
+type Transition struct {
+	stop chan struct{}
+	once sync.Once
+}
+
+// Start starts a transition. Step is called from another goroutine, with
+// progress 1 as its last call when the transition completes. A transition
+// without a duration completes on the first step.
+func Start(cfg Config, step Step) *Transition {
+	t := &Transition{stop: make(chan struct{})}
+	go t.run(cfg, step)
+	return t
+}
+
+func (t *Transition) run(cfg Config, step Step) {
+	start := time.Now()
+	ticker := time.NewTicker(frameInterval)
+	defer ticker.Stop()
+
+	for {
+		elapsed := time.Since(start)
+		if elapsed >= cfg.Duration {
+			step(t, 1)
+			return
+		}
+		step(t, cfg.Easing.apply(float64(elapsed)/float64(cfg.Duration)))
+
+		select {
+		case <-ticker.C:
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+// Stop stops the transition. A step that is already running still
+// completes, see Step.
+func (t *Transition) Stop() {
+	t.once.Do(func() {
+		close(t.stop)
+	})
+}
+
+// Lerp interpolates between from and to.
+func Lerp(from, to, progress float64) float64 {
+	return from + (to-from)*progress
+}
@@ -0,0 +1,136 @@
+package transition
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEasing(t *testing.T) {
+	for _, easing := range []Easing{Linear, EaseIn, EaseOut, EaseInOut} {
+		t.Run(string(easing), func(t *testing.T) {
+			if got := easing.apply(0); got != 0 {
+				t.Fatalf("apply(0) = %v, want 0", got)
+			}
+			if got := easing.apply(1); got != 1 {
+				t.Fatalf("apply(1) = %v, want 1", got)
+			}
+			previous := 0.0
+			for i := 1; i <= 100; i++ {
+				got := easing.apply(float64(i) / 100)
+				if got < previous {
+					t.Fatalf("apply(%v) = %v, below %v", float64(i)/100, got, previous)
+				}
+				previous = got
+			}
+		})
+	}
+
+	tests := []struct {
+		easing Easing
+		t      float64
+		want   float64
+	}{
+		{Linear, 0.25, 0.25},
+		{EaseIn, 0.5, 0.125},
+		{EaseOut, 0.5, 0.875},
+		{EaseInOut, 0.25, 0.0625},
+		{EaseInOut, 0.5, 0.5},
+		{EaseInOut, 0.75, 0.9375},
+	}
+	for _, test := range tests {
+		if got := test.easing.apply(test.t); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("%s apply(%v) = %v, want %v", test.easing, test.t, got, test.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Config{Duration: time.Second}
+	if err := cfg.Validate(); err != nil || cfg.Easing != EaseInOut {
+		t.Fatalf("got %v, easing %q, want easing %q", err, cfg.Easing, EaseInOut)
+	}
+	if err := (&Config{Duration: -time.Second}).Validate(); err == nil {
+		t.Fatal("negative duration did not fail")
+	}
+	if err := (&Config{Easing: "bounce"}).Validate(); err == nil {
+		t.Fatal("unknown easing did not fail")
+	}
+}
+
+// record starts a transition, and returns the progress of its steps once it
+// completes.
+func record(t *testing.T, cfg Config) []float64 {
+	t.Helper()
+	var mu sync.Mutex
+	var steps []float64
+	done := make(chan struct{})
+	Start(cfg, func(_ *Transition, progress float64) {
+		mu.Lock()
+		defer mu.Unlock()
+		steps = append(steps, progress)
+		if progress == 1 {
+			close(done)
+		}
+	})
+
+	select {
+	case <-done:
+	case <-time.After(time.Second + cfg.Duration):
+		t.Fatal("transition did not complete")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return steps
+}
+
+func TestStart(t *testing.T) {
+	steps := record(t, Config{Duration: 200 * time.Millisecond, Easing: Linear})
+	if len(steps) < 3 {
+		t.Fatalf("got %d steps, want more", len(steps))
+	}
+	for i := 1; i < len(steps); i++ {
+		if steps[i] < steps[i-1] {
+			t.Fatalf("steps go back: %v", steps)
+		}
+	}
+}
+
+func TestStartWithoutDuration(t *testing.T) {
+	steps := record(t, Config{Easing: Linear})
+	if len(steps) != 1 {
+		t.Fatalf("got steps %v, want only 1", steps)
+	}
+}
+
+func TestStop(t *testing.T) {
+	steps := make(chan float64, 100)
+	tr := Start(Config{Duration: time.Second, Easing: Linear}, func(_ *Transition, progress float64) {
+		steps <- progress
+	})
+	<-steps
+	tr.Stop()
+	tr.Stop()
+
+	time.Sleep(3 * frameInterval)
+	n := len(steps)
+	time.Sleep(3 * frameInterval)
+	if len(steps) != n {
+		t.Fatal("transition steps after it stopped")
+	}
+	for len(steps) > 0 {
+		if progress := <-steps; progress == 1 {
+			t.Fatal("stopped transition completed")
+		}
+	}
+}
+
+func TestLerp(t *testing.T) {
+	if got := Lerp(10, 20, 0.25); got != 12.5 {
+		t.Fatalf("Lerp(10, 20, 0.25) = %v, want 12.5", got)
+	}
+	if got := Lerp(1, 0, 1); got != 0 {
+		t.Fatalf("Lerp(1, 0, 1) = %v, want 0", got)
+	}
+}